@@ -0,0 +1,146 @@
+package marketcap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/interact"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// ApprovalConfig holds the orders of each cycle until an operator approves them,
+// with the /approve and /reject bot commands or the control API
+type ApprovalConfig struct {
+	// Timeout rejects the plan if it's not approved in time, 15m by default
+	Timeout types.Duration `json:"timeout"`
+}
+
+func (c *ApprovalConfig) Defaults() {
+	if c.Timeout == 0 {
+		c.Timeout = types.Duration(15 * time.Minute)
+	}
+}
+
+func (c *ApprovalConfig) Validate() error {
+	if c.Timeout < 0 {
+		return fmt.Errorf("approval.timeout should not less than 0")
+	}
+	return nil
+}
+
+// waitForApproval is a before rebalance hook, it notifies the plan and blocks until the plan is approved,
+// rejected or timed out, the dry run and the paper trading are never held
+func (s *Strategy) waitForApproval(ctx context.Context, plan *RebalancePlan) error {
+	if len(plan.Orders) == 0 || s.Paper != nil || s.isDryRun() {
+		return nil
+	}
+
+	decision := make(chan bool, 1)
+
+	s.statusMutex.Lock()
+	s.pendingApproval = decision
+	s.statusMutex.Unlock()
+
+	defer func() {
+		s.statusMutex.Lock()
+		s.pendingApproval = nil
+		s.statusMutex.Unlock()
+	}()
+
+	s.notify("", s.approvalMessage(plan))
+
+	// the operators answer in the wall clock time even in the deterministic mode
+	timer := time.NewTimer(s.Approval.Timeout.Duration())
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-timer.C:
+		s.notify("", fmt.Sprintf("%s plan is not approved in %s, skip the cycle", s.InstanceID(), s.Approval.Timeout.Duration()))
+		return fmt.Errorf("the plan is not approved in %s", s.Approval.Timeout.Duration())
+
+	case approved := <-decision:
+		if !approved {
+			return fmt.Errorf("the plan is rejected")
+		}
+
+		log.Infof("the plan is approved")
+
+		// the market moves while the plan waits, submit the approved quantities at the latest prices
+		return s.repricePlan(ctx, plan)
+	}
+}
+
+// repricePlan updates the order prices of the plan with the latest tickers
+func (s *Strategy) repricePlan(ctx context.Context, plan *RebalancePlan) error {
+	_, symbolPrices, err := s.pricer.Prices(ctx, s.TargetCurrencies, s.BaseCurrency, s.route)
+	if err != nil {
+		return err
+	}
+
+	indexes := make(map[string]int)
+	for i, symbol := range s.getSymbols() {
+		indexes[symbol] = i
+	}
+
+	for i, order := range plan.Orders {
+		if j, ok := indexes[order.Symbol]; ok {
+			plan.Orders[i].Price = symbolPrices[j]
+		}
+	}
+	plan.SymbolPrices = symbolPrices
+	return nil
+}
+
+func (s *Strategy) approvalMessage(plan *RebalancePlan) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s plan needs approval:\n", s.InstanceID())
+	for _, order := range plan.Orders {
+		fmt.Fprintf(&sb, "%s %s %s @ %s\n", order.Symbol, order.Side, order.Quantity.String(), order.Price.String())
+	}
+	fmt.Fprintf(&sb, "reply /approve or /reject in %s", s.Approval.Timeout.Duration())
+	return sb.String()
+}
+
+// Approve approves or rejects the plan waiting for approval
+func (s *Strategy) Approve(approved bool) error {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	if s.pendingApproval == nil {
+		return fmt.Errorf("no plan is waiting for approval")
+	}
+
+	select {
+	case s.pendingApproval <- approved:
+	default:
+		return fmt.Errorf("the plan is already answered")
+	}
+	return nil
+}
+
+// Commands registers the approval bot commands. The commands are global, so they answer the last registered
+// instance only; use the control API of each instance if several instances need approval.
+func (s *Strategy) Commands(i *interact.Interact) {
+	i.PrivateCommand("/approve", "Approve the pending marketcap plan", func(reply interact.Reply) error {
+		if err := s.Approve(true); err != nil {
+			reply.Message(err.Error())
+			return nil
+		}
+		reply.Message("the plan is approved")
+		return nil
+	})
+
+	i.PrivateCommand("/reject", "Reject the pending marketcap plan", func(reply interact.Reply) error {
+		if err := s.Approve(false); err != nil {
+			reply.Message(err.Error())
+			return nil
+		}
+		reply.Message("the plan is rejected")
+		return nil
+	})
+}
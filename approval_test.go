@@ -0,0 +1,105 @@
+package marketcap
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+func newApprovalStrategy(timeout time.Duration) *Strategy {
+	dryRun := false
+	return &Strategy{
+		DryRun:   &dryRun,
+		Approval: &ApprovalConfig{Timeout: types.Duration(timeout)},
+	}
+}
+
+func approvalPlan() *RebalancePlan {
+	return &RebalancePlan{
+		Orders: []types.SubmitOrder{
+			{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(1), Price: number(100)},
+		},
+	}
+}
+
+// answerApproval waits until the plan is pending and answers it
+func answerApproval(t *testing.T, s *Strategy, answer func()) {
+	t.Helper()
+
+	for i := 0; i < 1000; i++ {
+		s.statusMutex.Lock()
+		pending := s.pendingApproval != nil
+		s.statusMutex.Unlock()
+
+		if pending {
+			answer()
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("the plan is not pending")
+}
+
+func TestWaitForApproval(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		answer   func(s *Strategy) error
+		approved bool
+	}{
+		{"approve", func(s *Strategy) error { return s.Approve(true) }, true},
+		{"reject", func(s *Strategy) error { return s.Approve(false) }, false},
+		{"approve by the control API", func(s *Strategy) error {
+			if recorder := serveControl(s, http.MethodPost, "/approve"); recorder.Code != http.StatusOK {
+				t.Errorf("POST /approve status = %d, want %d", recorder.Code, http.StatusOK)
+			}
+			return nil
+		}, true},
+	} {
+		s := newApprovalStrategy(time.Minute)
+
+		result := make(chan error, 1)
+		go func() {
+			result <- s.waitForApproval(context.Background(), approvalPlan())
+		}()
+
+		answerApproval(t, s, func() {
+			if err := c.answer(s); err != nil {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+		})
+
+		if err := <-result; (err == nil) != c.approved {
+			t.Errorf("%s: got %v, approved %v", c.name, err, c.approved)
+		}
+
+		if err := s.Approve(true); err == nil {
+			t.Errorf("%s: the answered plan should not be pending", c.name)
+		}
+	}
+}
+
+func TestWaitForApprovalTimeout(t *testing.T) {
+	s := newApprovalStrategy(10 * time.Millisecond)
+	if err := s.waitForApproval(context.Background(), approvalPlan()); err == nil {
+		t.Fatal("the plan should be rejected after the timeout")
+	}
+}
+
+func TestWaitForApprovalDryRun(t *testing.T) {
+	s := newApprovalStrategy(time.Minute)
+	s.DryRun = nil
+
+	// the dry run is never held
+	if err := s.waitForApproval(context.Background(), approvalPlan()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestApproveWithoutPlan(t *testing.T) {
+	if err := newApprovalStrategy(time.Minute).Approve(true); err == nil {
+		t.Fatal("approving without a pending plan should fail")
+	}
+}
@@ -0,0 +1,103 @@
+package marketcap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// PlanEvent is published on the plan bus once per rebalance cycle, after the before rebalance hooks
+type PlanEvent struct {
+	InstanceID string
+	Time       time.Time
+	DryRun     bool
+
+	// Currencies are the target currencies with the base currency appended,
+	// the vectors of the plan are ordered the same way
+	Currencies []string
+	Plan       RebalancePlan
+}
+
+// PlanBus delivers the plan events to the registered callbacks and the subscribed channels
+type PlanBus struct {
+	mu          sync.Mutex
+	callbacks   []func(event PlanEvent)
+	subscribers map[chan PlanEvent]struct{}
+}
+
+// DefaultPlanBus is the bus all the marketcap strategy instances publish to,
+// co-located strategies can filter the events by InstanceID.
+var DefaultPlanBus = &PlanBus{}
+
+// OnPlan registers a callback, it's called synchronously in the rebalance so it should return quickly
+func (b *PlanBus) OnPlan(cb func(event PlanEvent)) {
+	b.mu.Lock()
+	b.callbacks = append(b.callbacks, cb)
+	b.mu.Unlock()
+}
+
+// Subscribe returns a channel receiving the plan events and the function to unsubscribe,
+// events are dropped if the channel buffer is full.
+func (b *PlanBus) Subscribe(buffer int) (<-chan PlanEvent, func()) {
+	ch := make(chan PlanEvent, buffer)
+
+	b.mu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan PlanEvent]struct{})
+	}
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers the event to the subscribers and then calls the callbacks without holding the lock,
+// so a callback can register callbacks or subscribe itself
+func (b *PlanBus) Publish(event PlanEvent) {
+	b.mu.Lock()
+	callbacks := append([]func(event PlanEvent){}, b.callbacks...)
+
+	// the sends never block, they stay under the lock since unsubscribing closes the channel
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Warnf("plan bus subscriber is full, drop the plan event of %s", event.InstanceID)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (s *Strategy) publishPlan(plan *RebalancePlan) {
+	event := PlanEvent{
+		InstanceID: s.InstanceID(),
+		Time:       s.Clock.Now(),
+		DryRun:     s.isDryRun(),
+		Currencies: append(append([]string{}, s.TargetCurrencies...), s.BaseCurrency),
+		Plan: RebalancePlan{
+			TargetWeights:  plan.TargetWeights.Copy(),
+			CurrentWeights: plan.CurrentWeights.Copy(),
+			Prices:         plan.Prices.Copy(),
+			SymbolPrices:   plan.SymbolPrices.Copy(),
+			Quantities:     plan.Quantities.Copy(),
+			Withdrawal:     plan.Withdrawal,
+			Contribution:   plan.Contribution,
+			Orders:         append([]types.SubmitOrder{}, plan.Orders...),
+		},
+	}
+
+	DefaultPlanBus.Publish(event)
+}
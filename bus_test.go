@@ -0,0 +1,54 @@
+package marketcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/narumiruna/bbgo-marketcap/clock"
+)
+
+func TestPlanBusCallbackReentrant(t *testing.T) {
+	bus := &PlanBus{}
+
+	calls := 0
+	bus.OnPlan(func(event PlanEvent) {
+		calls++
+		// registering from a callback must not deadlock the bus
+		bus.OnPlan(func(event PlanEvent) {
+			calls++
+		})
+	})
+
+	events, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	bus.Publish(PlanEvent{InstanceID: "a"})
+	bus.Publish(PlanEvent{InstanceID: "b"})
+
+	// the callback registered by the first event is called from the second event on
+	if calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+
+	// the buffer of the subscriber keeps the first event and the second one is dropped
+	if event := <-events; event.InstanceID != "a" {
+		t.Errorf("got event of %s, want a", event.InstanceID)
+	}
+}
+
+func TestPublishPlanCopiesCashFlows(t *testing.T) {
+	events, unsubscribe := DefaultPlanBus.Subscribe(1)
+	defer unsubscribe()
+
+	s := &Strategy{
+		BaseCurrency:     "USDT",
+		TargetCurrencies: []string{"BTC"},
+		Clock:            clock.NewManual(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	s.publishPlan(&RebalancePlan{Withdrawal: number(100), Contribution: number(50)})
+
+	event := <-events
+	if event.Plan.Withdrawal.Compare(number(100)) != 0 || event.Plan.Contribution.Compare(number(50)) != 0 {
+		t.Errorf("got withdrawal %v and contribution %v, want 100 and 50", event.Plan.Withdrawal, event.Plan.Contribution)
+	}
+}
@@ -0,0 +1,55 @@
+package marketcap
+
+import (
+	"context"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/clock"
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+)
+
+// seedClock moves an unset manual clock to the close time of the last closed kline, or to the wall clock
+// if the klines can not be queried, so the schedules do not start from the zero time
+func (s *Strategy) seedClock(ctx context.Context, session *bbgo.ExchangeSession) {
+	manual, ok := s.Clock.(*clock.Manual)
+	if !ok || !manual.Now().IsZero() {
+		return
+	}
+
+	symbols := s.getSymbols()
+	if len(symbols) > 0 {
+		queryCtx, cancel := timeout.Context(ctx, s.Timeouts.Ticker.Duration())
+		klines, err := session.Exchange.QueryKLines(queryCtx, symbols[0], s.Interval, types.KLineQueryOptions{Limit: 2})
+		cancel()
+		if err == nil {
+			if kline, ok := lastClosedKLine(klines, time.Now()); ok {
+				manual.Set(kline.EndTime.Time())
+				return
+			}
+		} else {
+			log.WithError(err).Warnf("can not query the klines of %s to seed the clock, use the wall clock", symbols[0])
+		}
+	}
+
+	manual.Set(time.Now())
+}
+
+// lastClosedKLine returns the last kline closed before now, the exchanges return the open kline as the last one
+func lastClosedKLine(klines []types.KLine, now time.Time) (types.KLine, bool) {
+	closed := closedKLines(klines, now)
+	if len(closed) == 0 {
+		return types.KLine{}, false
+	}
+	return closed[len(closed)-1], true
+}
+
+// closedKLines drops the klines not closed before now from the end of the klines
+func closedKLines(klines []types.KLine, now time.Time) []types.KLine {
+	for len(klines) > 0 && klines[len(klines)-1].EndTime.Time().After(now) {
+		klines = klines[:len(klines)-1]
+	}
+	return klines
+}
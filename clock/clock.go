@@ -0,0 +1,139 @@
+package clock
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock abstracts the time so the schedules can be driven deterministically
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the wall clock
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// Manual is a clock that only moves when it's set or advanced, e.g. by the kline close time in backtests.
+// Like time.Ticker, its tickers drop the ticks if the receiver falls behind.
+type Manual struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*manualTicker
+}
+
+func NewManual(now time.Time) *Manual {
+	return &Manual{now: now}
+}
+
+func (c *Manual) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Manual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for clock.Manual.NewTicker")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &manualTicker{
+		clock:    c,
+		interval: d,
+		next:     c.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d
+func (c *Manual) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to now and fires the due tickers, the clock never goes backward
+func (c *Manual) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Before(c.now) {
+		return
+	}
+	c.now = now
+
+	for _, t := range c.tickers {
+		if t.next.After(now) {
+			continue
+		}
+
+		select {
+		case t.c <- now:
+		default:
+		}
+
+		// skip the missed ticks at once, a long jump would take too many steps,
+		// and restart from now if the jump is too long for a duration
+		if gap := now.Sub(t.next); gap == math.MaxInt64 {
+			t.next = now.Add(t.interval)
+		} else {
+			t.next = t.next.Add((gap/t.interval + 1) * t.interval)
+		}
+	}
+}
+
+func (c *Manual) removeTicker(t *manualTicker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, tt := range c.tickers {
+		if tt == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+type manualTicker struct {
+	clock    *Manual
+	interval time.Duration
+	next     time.Time
+	c        chan time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.removeTicker(t)
+}
@@ -0,0 +1,64 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualTicker(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManual(start)
+	ticker := c.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	c.Advance(30 * time.Minute)
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker fired before the interval")
+	default:
+	}
+
+	c.Advance(30 * time.Minute)
+	select {
+	case now := <-ticker.C():
+		if !now.Equal(start.Add(time.Hour)) {
+			t.Fatalf("tick at %s, want %s", now, start.Add(time.Hour))
+		}
+	default:
+		t.Fatal("ticker did not fire at the interval")
+	}
+}
+
+func TestManualNeverGoesBackward(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManual(start)
+	c.Set(start.Add(-time.Hour))
+	if !c.Now().Equal(start) {
+		t.Fatalf("clock moved backward to %s", c.Now())
+	}
+}
+
+func TestManualSkipsMissedTicks(t *testing.T) {
+	c := NewManual(time.Time{})
+	ticker := c.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	// a jump from the zero time to now should not take a step per missed tick
+	now := time.Date(2022, 1, 1, 0, 0, 30, 0, time.UTC)
+	c.Set(now)
+	<-ticker.C()
+
+	c.Set(now.Add(59 * time.Second))
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker fired before the next interval")
+	default:
+	}
+
+	c.Set(now.Add(time.Minute))
+	select {
+	case <-ticker.C():
+	default:
+		t.Fatal("ticker did not fire at the next interval")
+	}
+}
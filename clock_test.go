@@ -0,0 +1,92 @@
+package marketcap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/clock"
+	"github.com/narumiruna/bbgo-marketcap/execution"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+	"github.com/narumiruna/bbgo-marketcap/weights"
+)
+
+func TestLastClosedKLine(t *testing.T) {
+	now := time.Date(2022, 1, 2, 12, 0, 0, 0, time.UTC)
+	klines := []types.KLine{
+		{EndTime: types.Time(time.Date(2022, 1, 1, 23, 59, 59, 0, time.UTC))},
+		{EndTime: types.Time(time.Date(2022, 1, 2, 23, 59, 59, 0, time.UTC))},
+	}
+
+	kline, ok := lastClosedKLine(klines, now)
+	if !ok || !kline.EndTime.Time().Equal(klines[0].EndTime.Time()) {
+		t.Fatalf("got %v %v, want the first kline", kline.EndTime, ok)
+	}
+
+	if _, ok := lastClosedKLine(klines[1:], now); ok {
+		t.Fatal("the open kline should not be returned")
+	}
+}
+
+// TestDeterministicCycle drives the refresh and the rebalance planning by the kline close times only
+func TestDeterministicCycle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewManual(start)
+
+	// the target weights move from 50/50 to 80/20 after the first refresh
+	targets := []vector.Vector{
+		vector.FromFloat64s([]float64{0.5, 0.5}),
+		vector.FromFloat64s([]float64{0.8, 0.2}),
+	}
+	fetches := make(chan int, 2)
+	n := 0
+	refresher := weights.NewRefresher(c, time.Hour, func(ctx context.Context) (vector.Vector, error) {
+		w := targets[n]
+		n++
+		fetches <- n
+		return w, nil
+	})
+	refresher.Start(ctx)
+
+	planner := &execution.Planner{Threshold: fixedpoint.NewFromFloat(0.02)}
+	symbols := []string{"BTCUSDT"}
+	prices := vector.FromFloat64s([]float64{100, 1})
+	marketValues := vector.FromFloat64s([]float64{500, 500})
+
+	cycle := func(klineEnd time.Time) []types.SubmitOrder {
+		c.Set(klineEnd)
+		targetWeights, updatedAt, err := refresher.Weights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updatedAt.After(klineEnd) {
+			t.Fatalf("weights updated at %s after the kline close %s", updatedAt, klineEnd)
+		}
+		return planner.Plan(symbols, prices, prices, marketValues, targetWeights)
+	}
+
+	<-fetches
+	if orders := cycle(start.Add(30 * time.Minute)); len(orders) != 0 {
+		t.Fatalf("got %d orders at the target, want none", len(orders))
+	}
+
+	// the refresh is due on the kline of the next hour
+	c.Set(start.Add(time.Hour))
+	<-fetches
+
+	orders := cycle(start.Add(time.Hour))
+	if len(orders) != 1 || orders[0].Side != types.SideTypeBuy {
+		t.Fatalf("got %v, want one buy", orders)
+	}
+
+	// 30% of 1000 at 100
+	if orders[0].Quantity.Compare(fixedpoint.NewFromInt(3)) != 0 {
+		t.Fatalf("got quantity %v, want 3", orders[0].Quantity)
+	}
+}
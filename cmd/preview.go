@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/cmd"
+
+	"github.com/narumiruna/bbgo-marketcap"
+)
+
+var marketcapCmd = &cobra.Command{
+	Use:   "marketcap",
+	Short: "marketcap strategy tools",
+}
+
+var previewCmd = &cobra.Command{
+	Use:          "preview",
+	Short:        "print the order plan of the marketcap strategies in the config without submitting orders",
+	SilenceUsage: true,
+	RunE: func(c *cobra.Command, args []string) error {
+		configFile, err := c.Flags().GetString("config")
+		if err != nil {
+			return err
+		}
+
+		if len(configFile) == 0 {
+			return fmt.Errorf("--config option is required")
+		}
+
+		userConfig, err := bbgo.Load(configFile, true)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		environ := bbgo.NewEnvironment()
+		if err := environ.ConfigureExchangeSessions(userConfig); err != nil {
+			return err
+		}
+
+		if err := environ.Init(ctx); err != nil {
+			return err
+		}
+
+		found := false
+		for _, mount := range userConfig.ExchangeStrategies {
+			strategy, ok := mount.Strategy.(*marketcap.Strategy)
+			if !ok {
+				continue
+			}
+
+			for _, sessionName := range mount.Mounts {
+				session, ok := environ.Session(sessionName)
+				if !ok {
+					return fmt.Errorf("session %s is not defined", sessionName)
+				}
+
+				found = true
+				strategy.Environment = environ
+				if err := strategy.Preview(ctx, session, os.Stdout); err != nil {
+					return err
+				}
+				fmt.Println()
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("no %s strategy found in %s", marketcap.ID, configFile)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	marketcapCmd.AddCommand(previewCmd)
+	cmd.RootCmd.AddCommand(marketcapCmd)
+}
@@ -0,0 +1,201 @@
+package marketcap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/execution"
+)
+
+type ControlServerConfig struct {
+	// Bind is the address the control server listens on, e.g. "127.0.0.1:8089"
+	Bind string `json:"bind"`
+}
+
+type Status struct {
+	InstanceID        string    `json:"instanceID"`
+	Paused            bool      `json:"paused"`
+	RiskOff           bool      `json:"riskOff"`
+	PendingApproval   bool      `json:"pendingApproval"`
+	DryRun            bool      `json:"dryRun"`
+	LastRebalanceTime time.Time `json:"lastRebalanceTime"`
+	LastError         string    `json:"lastError,omitempty"`
+
+	PlannedWithdrawal fixedpoint.Value `json:"plannedWithdrawal"`
+
+	// Positions are the positions tracked from the trades of the strategy orders
+	Positions []execution.PositionStatus `json:"positions,omitempty"`
+
+	// Paper is the hypothetical performance in the paper mode
+	Paper *PaperPerformance `json:"paper,omitempty"`
+}
+
+type Weight struct {
+	Currency string           `json:"currency"`
+	Weight   fixedpoint.Value `json:"weight"`
+}
+
+func (s *Strategy) Status() Status {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	status := Status{
+		InstanceID:        s.InstanceID(),
+		Paused:            s.paused,
+		RiskOff:           s.riskOff,
+		PendingApproval:   s.pendingApproval != nil,
+		DryRun:            s.isDryRun(),
+		LastRebalanceTime: s.lastRebalanceTime,
+		PlannedWithdrawal: s.PlannedWithdrawal,
+	}
+	if s.lastError != nil {
+		status.LastError = s.lastError.Error()
+	}
+	if s.orderExecutor != nil {
+		status.Positions = s.orderExecutor.Positions()
+	}
+	if s.paperAccount != nil {
+		performance := s.paperAccount.performance()
+		status.Paper = &performance
+	}
+	return status
+}
+
+// Weights returns the target weights computed by the last rebalance, the base currency comes last
+func (s *Strategy) Weights() []Weight {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	if len(s.lastTargetWeights) != len(s.TargetCurrencies)+1 {
+		return nil
+	}
+
+	var weights []Weight
+	for i, currency := range s.TargetCurrencies {
+		weights = append(weights, Weight{Currency: currency, Weight: s.lastTargetWeights[i]})
+	}
+	weights = append(weights, Weight{Currency: s.BaseCurrency, Weight: s.lastTargetWeights[len(s.TargetCurrencies)]})
+	return weights
+}
+
+// startControlServer serves the control API until ctx is done:
+//
+//	GET  /status     the current status of the strategy
+//	GET  /weights    the target weights of the last rebalance
+//	POST /rebalance  trigger a rebalance immediately
+//	POST /pause      stop rebalancing on kline close
+//	POST /resume     resume rebalancing on kline close
+//	POST /withdrawal reserve ?amount= of base currency for a planned withdrawal, 0 cancels it
+//	POST /approve    approve the plan waiting for approval
+//	POST /reject     reject the plan waiting for approval
+func (s *Strategy) startControlServer(ctx context.Context, config *ControlServerConfig) error {
+	if len(config.Bind) == 0 {
+		return fmt.Errorf("controlServer.bind should not be empty")
+	}
+
+	server := &http.Server{
+		Addr:    config.Bind,
+		Handler: s.controlHandler(),
+	}
+
+	go func() {
+		log.Infof("control server listening on %s", config.Bind)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("control server error")
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.WithError(err).Error("control server shutdown error")
+		}
+	}()
+
+	return nil
+}
+
+// controlHandler routes the requests of the control API
+func (s *Strategy) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleGet(func() interface{} { return s.Status() }))
+	mux.HandleFunc("/weights", s.handleGet(func() interface{} { return s.Weights() }))
+	mux.HandleFunc("/rebalance", s.handlePost(func() error {
+		if s.triggerRebalance == nil {
+			return fmt.Errorf("strategy is not running")
+		}
+		return s.triggerRebalance()
+	}))
+	mux.HandleFunc("/pause", s.handlePost(func() error {
+		s.setPaused(true)
+		return nil
+	}))
+	mux.HandleFunc("/resume", s.handlePost(func() error {
+		s.setPaused(false)
+		return nil
+	}))
+
+	mux.HandleFunc("/approve", s.handlePost(func() error {
+		return s.Approve(true)
+	}))
+	mux.HandleFunc("/reject", s.handlePost(func() error {
+		return s.Approve(false)
+	}))
+
+	mux.HandleFunc("/withdrawal", func(w http.ResponseWriter, r *http.Request) {
+		amount, err := fixedpoint.NewFromString(r.URL.Query().Get("amount"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		s.handlePost(func() error {
+			return s.PlanWithdrawal(amount)
+		})(w, r)
+	})
+	return mux
+}
+
+func (s *Strategy) handleGet(f func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, f())
+	}
+}
+
+func (s *Strategy) handlePost(f func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := f(); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, s.Status())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("control server encode error")
+	}
+}
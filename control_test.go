@@ -0,0 +1,108 @@
+package marketcap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+func serveControl(s *Strategy, method, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.controlHandler().ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder
+}
+
+func TestControlPauseResume(t *testing.T) {
+	s := &Strategy{}
+
+	recorder := serveControl(s, http.MethodPost, "/pause")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("POST /pause status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	var status Status
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !status.Paused || !s.isPaused() {
+		t.Errorf("the strategy should be paused")
+	}
+
+	serveControl(s, http.MethodPost, "/resume")
+	if s.isPaused() {
+		t.Errorf("the strategy should be resumed")
+	}
+}
+
+func TestControlMethodNotAllowed(t *testing.T) {
+	s := &Strategy{}
+	for _, c := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/status"},
+		{http.MethodPost, "/weights"},
+		{http.MethodGet, "/rebalance"},
+		{http.MethodGet, "/pause"},
+	} {
+		if recorder := serveControl(s, c.method, c.path); recorder.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s status = %d, want %d", c.method, c.path, recorder.Code, http.StatusMethodNotAllowed)
+		}
+	}
+
+	if s.isPaused() {
+		t.Errorf("GET /pause should not pause the strategy")
+	}
+}
+
+func TestControlRebalanceNotRunning(t *testing.T) {
+	recorder := serveControl(&Strategy{}, http.MethodPost, "/rebalance")
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("POST /rebalance status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+
+	var body map[string]string
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body["error"] != "strategy is not running" {
+		t.Errorf("error = %q, want %q", body["error"], "strategy is not running")
+	}
+}
+
+func TestControlWeights(t *testing.T) {
+	s := &Strategy{
+		BaseCurrency:      "USDT",
+		TargetCurrencies:  []string{"BTC", "ETH"},
+		lastTargetWeights: vector.FromFloat64s([]float64{0.6, 0.3, 0.1}),
+	}
+
+	recorder := serveControl(s, http.MethodGet, "/weights")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /weights status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	var weights []Weight
+	if err := json.NewDecoder(recorder.Body).Decode(&weights); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Weight{
+		{"BTC", fixedpoint.NewFromFloat(0.6)},
+		{"ETH", fixedpoint.NewFromFloat(0.3)},
+		{"USDT", fixedpoint.NewFromFloat(0.1)},
+	}
+	if len(weights) != len(want) {
+		t.Fatalf("weights %v, want %v", weights, want)
+	}
+	for i := range want {
+		if weights[i].Currency != want[i].Currency || weights[i].Weight.Compare(want[i].Weight) != 0 {
+			t.Errorf("weights %v, want %v", weights, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package marketcap
+
+import (
+	"context"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+)
+
+// DepthService is implemented by the exchanges that can query the order book depth of a symbol, e.g. binance and kucoin,
+// the second return value is the update id of the snapshot
+type DepthService interface {
+	QueryDepth(ctx context.Context, symbol string) (types.SliceOrderBook, int64, error)
+}
+
+// OrderCost is the estimated execution cost of a planned order in the base currency
+type OrderCost struct {
+	Symbol string
+	// Amount is the value of the order
+	Amount fixedpoint.Value
+	Fee    fixedpoint.Value
+	// Slippage is the cost of walking the order book away from the plan price,
+	// it's unknown if the exchange can not query the depth
+	Slippage      fixedpoint.Value
+	SlippageKnown bool
+	// DepthExhausted is true if the order is larger than the queried depth
+	DepthExhausted bool
+}
+
+// estimateCosts estimates the taker fee of each order by the session fee rate and the slippage by the order book depth
+func (s *Strategy) estimateCosts(ctx context.Context, session *bbgo.ExchangeSession, plan *RebalancePlan) (costs []OrderCost, total fixedpoint.Value) {
+	symbols := s.getSymbols()
+	total = fixedpoint.Zero
+
+	// the fee rates of the session are only set by the config, they are zero otherwise
+	if session.TakerFeeRate.IsZero() {
+		log.Warnf("takerFeeRate of session %s is not set, the fees are estimated as 0", session.Name)
+	}
+
+	depthService, hasDepth := session.Exchange.(DepthService)
+	for _, order := range plan.Orders {
+		// the amounts are in the quote currency of the symbol, convert them by the plan prices
+		toBase := fixedpoint.One
+		for i, symbol := range symbols {
+			if symbol == order.Symbol && plan.SymbolPrices[i].Sign() > 0 {
+				toBase = plan.Prices[i].Div(plan.SymbolPrices[i])
+				break
+			}
+		}
+
+		amount := order.Quantity.Mul(order.Price).Mul(toBase)
+		cost := OrderCost{
+			Symbol: order.Symbol,
+			Amount: amount,
+			Fee:    amount.Mul(session.TakerFeeRate),
+		}
+
+		if hasDepth {
+			depthCtx, cancel := timeout.Context(ctx, s.Timeouts.Ticker.Duration())
+			book, _, err := depthService.QueryDepth(depthCtx, order.Symbol)
+			cancel()
+			if err != nil {
+				log.WithError(err).Warnf("can not query the depth of %s, the slippage is unknown", order.Symbol)
+			} else {
+				slippage, exhausted := estimateSlippage(order, book)
+				cost.Slippage = slippage.Mul(toBase)
+				cost.SlippageKnown = true
+				cost.DepthExhausted = exhausted
+			}
+		}
+
+		total = total.Add(cost.Fee).Add(cost.Slippage)
+		costs = append(costs, cost)
+	}
+
+	return costs, total
+}
+
+// estimateSlippage walks the opposite side of the book and returns the extra cost in the quote currency
+// compared with filling the whole order at its price, the last level is used if the depth is exhausted
+func estimateSlippage(order types.SubmitOrder, book types.SliceOrderBook) (fixedpoint.Value, bool) {
+	levels := book.Asks
+	if order.Side == types.SideTypeSell {
+		levels = book.Bids
+	}
+
+	if len(levels) == 0 {
+		return fixedpoint.Zero, true
+	}
+
+	remaining := order.Quantity
+	amount := fixedpoint.Zero
+	for _, level := range levels {
+		if remaining.Sign() <= 0 {
+			break
+		}
+
+		quantity := fixedpoint.Min(remaining, level.Volume)
+		amount = amount.Add(quantity.Mul(level.Price))
+		remaining = remaining.Sub(quantity)
+	}
+
+	exhausted := remaining.Sign() > 0
+	if exhausted {
+		amount = amount.Add(remaining.Mul(levels[len(levels)-1].Price))
+	}
+
+	expected := order.Quantity.Mul(order.Price)
+	if order.Side == types.SideTypeSell {
+		return expected.Sub(amount), exhausted
+	}
+	return amount.Sub(expected), exhausted
+}
+
+// logCosts logs the estimated costs of the orders and their total
+func (s *Strategy) logCosts(plan *RebalancePlan, costs []OrderCost, total fixedpoint.Value) {
+	traded := fixedpoint.Zero
+	for i, cost := range costs {
+		traded = traded.Add(cost.Amount)
+		slippage := "unknown"
+		if cost.SlippageKnown {
+			slippage = cost.Slippage.String()
+		}
+		if cost.DepthExhausted {
+			slippage += " (depth exhausted)"
+		}
+		log.Infof("estimated cost of %s %s: fee %s, slippage %s %s", cost.Symbol, plan.Orders[i].Side, cost.Fee.String(), slippage, s.BaseCurrency)
+	}
+
+	if traded.Sign() > 0 {
+		log.Infof("estimated total cost: %s %s, %s of the traded %s %s",
+			total.String(), s.BaseCurrency, total.Div(traded).Percentage(), traded.String(), s.BaseCurrency)
+	}
+}
@@ -0,0 +1,58 @@
+package marketcap
+
+import (
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+func testBook() types.SliceOrderBook {
+	return types.SliceOrderBook{
+		Symbol: "BTCUSDT",
+		Bids: types.PriceVolumeSlice{
+			{Price: fixedpoint.NewFromFloat(99), Volume: fixedpoint.NewFromFloat(1)},
+			{Price: fixedpoint.NewFromFloat(98), Volume: fixedpoint.NewFromFloat(1)},
+		},
+		Asks: types.PriceVolumeSlice{
+			{Price: fixedpoint.NewFromFloat(101), Volume: fixedpoint.NewFromFloat(1)},
+			{Price: fixedpoint.NewFromFloat(102), Volume: fixedpoint.NewFromFloat(1)},
+		},
+	}
+}
+
+func TestEstimateSlippage(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		side      types.SideType
+		quantity  float64
+		slippage  float64
+		exhausted bool
+	}{
+		// 1 @ 101 + 0.5 @ 102 against 1.5 @ 100
+		{"buy walks the asks", types.SideTypeBuy, 1.5, 2, false},
+		// 1.5 @ 100 against 1 @ 99 + 0.5 @ 98
+		{"sell walks the bids", types.SideTypeSell, 1.5, 2, false},
+		// 1 @ 101 + 1 @ 102 and the 1 beyond the depth at the last level 102 against 3 @ 100
+		{"depth exhausted", types.SideTypeBuy, 3, 5, true},
+	} {
+		order := types.SubmitOrder{
+			Symbol:   "BTCUSDT",
+			Side:     c.side,
+			Quantity: fixedpoint.NewFromFloat(c.quantity),
+			Price:    fixedpoint.NewFromFloat(100),
+		}
+
+		slippage, exhausted := estimateSlippage(order, testBook())
+		if slippage.Compare(fixedpoint.NewFromFloat(c.slippage)) != 0 || exhausted != c.exhausted {
+			t.Errorf("%s: slippage = %v, exhausted = %v, want %v, %v", c.name, slippage, exhausted, c.slippage, c.exhausted)
+		}
+	}
+}
+
+func TestEstimateSlippageEmptyBook(t *testing.T) {
+	order := types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeSell, Quantity: fixedpoint.One, Price: fixedpoint.NewFromFloat(100)}
+	if _, exhausted := estimateSlippage(order, types.SliceOrderBook{Symbol: "BTCUSDT"}); !exhausted {
+		t.Errorf("the empty book should be exhausted")
+	}
+}
@@ -0,0 +1,158 @@
+package marketcap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// DCAConfig deploys new base currency with buy-only orders according to the target weights,
+// instead of waiting for the drift threshold to trigger the rebalance. The contribution buys are netted with the
+// rebalance orders of the cycle.
+type DCAConfig struct {
+	// Amount is the scheduled contribution in the base currency deployed every Interval. It's drawn from the idle
+	// base currency of the account, or from the detected deposits only when detectDeposits is set.
+	Amount fixedpoint.Value `json:"amount"`
+	// Interval is the interval of the scheduled contribution
+	Interval types.Duration `json:"interval"`
+	// DetectDeposits deploys the base currency deposited between the cycles, at once unless amount is set
+	DetectDeposits bool `json:"detectDeposits"`
+}
+
+func (c *DCAConfig) Validate() error {
+	if c.Amount.Sign() < 0 {
+		return fmt.Errorf("dca.amount should not less than 0")
+	}
+
+	if c.Amount.Sign() > 0 && c.Interval <= 0 {
+		return fmt.Errorf("dca.interval should be greater than 0 when dca.amount is set")
+	}
+
+	if c.Amount.IsZero() && !c.DetectDeposits {
+		return fmt.Errorf("dca needs either dca.amount or dca.detectDeposits")
+	}
+
+	return nil
+}
+
+// dcaTracker tracks the base currency flow of the strategy trades,
+// so the deposits can be told apart from the proceeds of the strategy's own orders.
+type dcaTracker struct {
+	mu sync.Mutex
+
+	// lastBaseBalance is the base currency balance at the last committed cycle, nil before the first cycle
+	lastBaseBalance *fixedpoint.Value
+	// tradeFlow is the base currency received (positive) or spent (negative) by the trades since the last cycle
+	tradeFlow fixedpoint.Value
+	// pendingDeposits are the detected deposits not deployed yet
+	pendingDeposits fixedpoint.Value
+
+	nextContributionTime time.Time
+}
+
+// dcaCycle is the contribution planned in a cycle, the tracker is only updated when the cycle is committed
+type dcaCycle struct {
+	Amount fixedpoint.Value
+
+	time        time.Time
+	baseBalance fixedpoint.Value
+	tradeFlow   fixedpoint.Value
+	deposits    fixedpoint.Value
+	scheduled   bool
+}
+
+func (t *dcaTracker) handleTrade(baseCurrency string, market types.Market, trade types.Trade) {
+	if market.QuoteCurrency != baseCurrency {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch trade.Side {
+	case types.SideTypeBuy:
+		t.tradeFlow = t.tradeFlow.Sub(trade.QuoteQuantity)
+	case types.SideTypeSell:
+		t.tradeFlow = t.tradeFlow.Add(trade.QuoteQuantity)
+	}
+
+	if trade.FeeCurrency == baseCurrency {
+		t.tradeFlow = t.tradeFlow.Sub(trade.Fee)
+	}
+}
+
+// contribution plans the amount of base currency to deploy in this cycle, at most spendable.
+// The tracking is not changed until the cycle is committed, so a cycle that is not submitted deploys it again.
+func (t *dcaTracker) contribution(config *DCAConfig, now time.Time, baseBalance, spendable fixedpoint.Value, detectDeposits bool) dcaCycle {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cycle := dcaCycle{
+		time:        now,
+		baseBalance: baseBalance,
+		tradeFlow:   t.tradeFlow,
+		deposits:    t.pendingDeposits,
+		scheduled:   config.Amount.Sign() > 0 && !now.Before(t.nextContributionTime),
+	}
+
+	if detectDeposits && t.lastBaseBalance != nil {
+		expected := t.lastBaseBalance.Add(t.tradeFlow)
+		if deposit := baseBalance.Sub(expected); deposit.Sign() > 0 {
+			log.Infof("detected %s deposit of base currency", deposit.String())
+			cycle.deposits = cycle.deposits.Add(deposit)
+		}
+	}
+
+	amount := fixedpoint.Zero
+	switch {
+	case detectDeposits && cycle.scheduled:
+		amount = fixedpoint.Min(config.Amount, cycle.deposits)
+	case detectDeposits && config.Amount.IsZero():
+		amount = cycle.deposits
+	case !detectDeposits && cycle.scheduled:
+		amount = config.Amount
+	}
+
+	cycle.Amount = fixedpoint.Max(fixedpoint.Min(amount, spendable), fixedpoint.Zero)
+	return cycle
+}
+
+// commit records the cycle after its orders are submitted, the trades received meanwhile are kept for the next cycle
+func (t *dcaTracker) commit(config *DCAConfig, cycle dcaCycle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastBaseBalance = &cycle.baseBalance
+	t.tradeFlow = t.tradeFlow.Sub(cycle.tradeFlow)
+	t.pendingDeposits = fixedpoint.Max(cycle.deposits.Sub(cycle.Amount), fixedpoint.Zero)
+
+	if cycle.scheduled {
+		t.nextContributionTime = cycle.time.Add(config.Interval.Duration())
+	}
+}
+
+func (s *Strategy) handleDCATrade(trade types.Trade) {
+	market, ok := s.session.Market(trade.Symbol)
+	if !ok {
+		return
+	}
+	s.dcaTracker.handleTrade(s.BaseCurrency, market, trade)
+}
+
+// planContribution plans the contribution of the cycle from the base currency of the account. The deposits are
+// detected on the balance of the account, but the cash reserved for the withdrawal is not deployed. The paper
+// account never receives deposits, so only the scheduled amount is deployed in the paper mode.
+func (s *Strategy) planContribution(spendable, withdrawal fixedpoint.Value) *dcaCycle {
+	cycle := s.dcaTracker.contribution(s.DCA, s.Clock.Now(), spendable.Add(withdrawal), spendable, s.DCA.DetectDeposits && s.Paper == nil)
+	return &cycle
+}
+
+// commitContribution updates the DCA tracking after the orders of the plan are submitted
+func (s *Strategy) commitContribution(plan *RebalancePlan) {
+	if plan.contribution != nil {
+		s.dcaTracker.commit(s.DCA, *plan.contribution)
+	}
+}
@@ -0,0 +1,94 @@
+package marketcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+func TestDCATrackerScheduledAmount(t *testing.T) {
+	config := &DCAConfig{Amount: fixedpoint.NewFromInt(100), Interval: types.Duration(time.Hour)}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	balance := fixedpoint.NewFromInt(1000)
+
+	var tracker dcaTracker
+	cycle := tracker.contribution(config, now, balance, balance, false)
+	if cycle.Amount.Compare(config.Amount) != 0 {
+		t.Fatalf("contribution = %s, want %s", cycle.Amount.String(), config.Amount.String())
+	}
+
+	// the cycle is not committed, e.g. dry run or a failed submission, so the amount is planned again
+	cycle = tracker.contribution(config, now.Add(time.Minute), balance, balance, false)
+	if cycle.Amount.Compare(config.Amount) != 0 {
+		t.Fatalf("contribution of the uncommitted cycle = %s, want %s", cycle.Amount.String(), config.Amount.String())
+	}
+
+	tracker.commit(config, cycle)
+	cycle = tracker.contribution(config, now.Add(30*time.Minute), balance, balance, false)
+	if !cycle.Amount.IsZero() {
+		t.Fatalf("contribution before the interval = %s, want 0", cycle.Amount.String())
+	}
+
+	cycle = tracker.contribution(config, now.Add(time.Minute+time.Hour), balance, fixedpoint.NewFromInt(40), false)
+	if cycle.Amount.Compare(fixedpoint.NewFromInt(40)) != 0 {
+		t.Fatalf("contribution = %s, want it capped by the spendable 40", cycle.Amount.String())
+	}
+}
+
+func TestDCATrackerDetectDeposits(t *testing.T) {
+	config := &DCAConfig{DetectDeposits: true}
+	market := types.Market{BaseCurrency: "BTC", QuoteCurrency: "USDT"}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tracker dcaTracker
+	balance := fixedpoint.NewFromInt(1000)
+	cycle := tracker.contribution(config, now, balance, balance, true)
+	if !cycle.Amount.IsZero() {
+		t.Fatalf("contribution of the first cycle = %s, want 0", cycle.Amount.String())
+	}
+	tracker.commit(config, cycle)
+
+	// a sell of the strategy is not a deposit, the extra 500 is
+	tracker.handleTrade("USDT", market, types.Trade{Side: types.SideTypeSell, QuoteQuantity: fixedpoint.NewFromInt(200)})
+	balance = fixedpoint.NewFromInt(1700)
+	cycle = tracker.contribution(config, now.Add(time.Hour), balance, balance, true)
+	if cycle.Amount.Compare(fixedpoint.NewFromInt(500)) != 0 {
+		t.Fatalf("contribution = %s, want 500", cycle.Amount.String())
+	}
+
+	// the buys of the contribution fill before the commit, they are kept for the next cycle
+	tracker.handleTrade("USDT", market, types.Trade{Side: types.SideTypeBuy, QuoteQuantity: fixedpoint.NewFromInt(500)})
+	tracker.commit(config, cycle)
+
+	balance = fixedpoint.NewFromInt(1200)
+	cycle = tracker.contribution(config, now.Add(2*time.Hour), balance, balance, true)
+	if !cycle.Amount.IsZero() {
+		t.Fatalf("contribution after the deployment = %s, want 0", cycle.Amount.String())
+	}
+}
+
+func TestDCATrackerScheduledDeposits(t *testing.T) {
+	config := &DCAConfig{Amount: fixedpoint.NewFromInt(100), Interval: types.Duration(time.Hour), DetectDeposits: true}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tracker dcaTracker
+	balance := fixedpoint.NewFromInt(1000)
+	cycle := tracker.contribution(config, now, balance, balance, true)
+	if !cycle.Amount.IsZero() {
+		t.Fatalf("contribution without deposits = %s, want 0", cycle.Amount.String())
+	}
+	tracker.commit(config, cycle)
+
+	// the deposit of 250 is deployed by the scheduled amount
+	balance = fixedpoint.NewFromInt(1250)
+	for i, want := range []int64{100, 100, 50, 0} {
+		now = now.Add(time.Hour)
+		cycle = tracker.contribution(config, now, balance, balance, true)
+		if cycle.Amount.Compare(fixedpoint.NewFromInt(want)) != 0 {
+			t.Fatalf("contribution %d = %s, want %d", i, cycle.Amount.String(), want)
+		}
+		tracker.commit(config, cycle)
+	}
+}
@@ -0,0 +1,45 @@
+package marketcap
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var rebalanceErrorsMetrics = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bbgo_marketcap_rebalance_errors_total",
+		Help: "the number of the failed rebalances",
+	}, []string{"instance"})
+
+func init() {
+	prometheus.MustRegister(rebalanceErrorsMetrics)
+}
+
+// handleRebalanceError logs the rebalance error, counts it in the metrics and
+// notifies every errorNotifyThreshold consecutive failures. A nil error resets the failure count.
+func (s *Strategy) handleRebalanceError(err error) {
+	// the context is canceled on shutdown, it's not a failure of the strategy
+	if errors.Is(err, context.Canceled) {
+		log.WithError(err).Warn("rebalance canceled")
+		return
+	}
+
+	s.statusMutex.Lock()
+	if err == nil {
+		s.consecutiveErrors = 0
+		s.statusMutex.Unlock()
+		return
+	}
+	s.consecutiveErrors++
+	consecutiveErrors := s.consecutiveErrors
+	s.statusMutex.Unlock()
+
+	log.WithError(err).Errorf("rebalance error (%d consecutive)", consecutiveErrors)
+	rebalanceErrorsMetrics.WithLabelValues(s.InstanceID()).Inc()
+
+	if s.ErrorNotifyThreshold > 0 && consecutiveErrors%s.ErrorNotifyThreshold == 0 {
+		s.notifyError("%s rebalance failed %d times in a row: %v", s.InstanceID(), consecutiveErrors, err)
+	}
+}
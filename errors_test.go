@@ -0,0 +1,49 @@
+package marketcap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestHandleRebalanceErrorCanceled(t *testing.T) {
+	s := &Strategy{}
+
+	s.handleRebalanceError(fmt.Errorf("submit error: %w", context.Canceled))
+	if s.consecutiveErrors != 0 {
+		t.Errorf("consecutive errors = %d after a cancellation, want 0", s.consecutiveErrors)
+	}
+
+	s.handleRebalanceError(fmt.Errorf("query ticker error"))
+	s.handleRebalanceError(context.Canceled)
+	if s.consecutiveErrors != 1 {
+		t.Errorf("consecutive errors = %d, want 1", s.consecutiveErrors)
+	}
+
+	s.handleRebalanceError(nil)
+	if s.consecutiveErrors != 0 {
+		t.Errorf("consecutive errors = %d after a success, want 0", s.consecutiveErrors)
+	}
+}
+
+func TestErrorNotifyThresholdDefaults(t *testing.T) {
+	for config, want := range map[string]int{
+		`{"targetCurrencies": ["BTC"]}`:                            3,
+		`{"targetCurrencies": ["BTC"], "errorNotifyThreshold": 0}`: 0,
+		`{"targetCurrencies": ["BTC"], "errorNotifyThreshold": 5}`: 5,
+	} {
+		var s Strategy
+		if err := json.Unmarshal([]byte(config), &s); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := s.Defaults(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if s.ErrorNotifyThreshold != want {
+			t.Errorf("%s: errorNotifyThreshold = %d, want %d", config, s.ErrorNotifyThreshold, want)
+		}
+	}
+}
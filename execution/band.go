@@ -0,0 +1,43 @@
+package execution
+
+import (
+	"fmt"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+// Band is the tolerance band of the weights, an asset is traded when its weight drifts from the target
+// by Absolute percentage points or by Relative of the target weight, whichever is smaller.
+// The classic 5/25 rule is Band{Absolute: 5%, Relative: 25%}.
+type Band struct {
+	Absolute fixedpoint.Value `json:"absolute"`
+	Relative fixedpoint.Value `json:"relative"`
+}
+
+func (b *Band) Defaults() {
+	if b.Absolute.IsZero() && b.Relative.IsZero() {
+		b.Absolute = fixedpoint.NewFromFloat(0.05)
+		b.Relative = fixedpoint.NewFromFloat(0.25)
+	}
+}
+
+func (b *Band) Validate() error {
+	if b.Absolute.Sign() < 0 || b.Relative.Sign() < 0 {
+		return fmt.Errorf("band.absolute and band.relative should not less than 0")
+	}
+	return nil
+}
+
+// Threshold returns the weight difference that triggers the trade of the target weight,
+// a zero bound is ignored.
+func (b *Band) Threshold(targetWeight fixedpoint.Value) fixedpoint.Value {
+	relative := b.Relative.Mul(targetWeight.Abs())
+
+	switch {
+	case b.Relative.IsZero():
+		return b.Absolute
+	case b.Absolute.IsZero():
+		return relative
+	}
+	return fixedpoint.Min(b.Absolute, relative)
+}
@@ -0,0 +1,37 @@
+package execution
+
+import "testing"
+
+func TestBandThreshold(t *testing.T) {
+	for _, c := range []struct {
+		band         Band
+		targetWeight float64
+		want         float64
+	}{
+		// the 5/25 rule: the absolute bound for the large weights, the relative bound for the small ones
+		{Band{Absolute: number(0.05), Relative: number(0.25)}, 0.4, 0.05},
+		{Band{Absolute: number(0.05), Relative: number(0.25)}, 0.1, 0.025},
+		{Band{Absolute: number(0.05), Relative: number(0.25)}, -0.1, 0.025},
+		// a zero bound is ignored
+		{Band{Absolute: number(0.05)}, 0.1, 0.05},
+		{Band{Relative: number(0.25)}, 0.4, 0.1},
+	} {
+		if got := c.band.Threshold(number(c.targetWeight)); got.Compare(number(c.want)) != 0 {
+			t.Errorf("band %+v threshold of %v = %v, want %v", c.band, c.targetWeight, got, c.want)
+		}
+	}
+}
+
+func TestBandDefaults(t *testing.T) {
+	var band Band
+	band.Defaults()
+	if band.Absolute.Compare(number(0.05)) != 0 || band.Relative.Compare(number(0.25)) != 0 {
+		t.Errorf("default band %+v, want the 5/25 rule", band)
+	}
+
+	band = Band{Relative: number(0.1)}
+	band.Defaults()
+	if !band.Absolute.IsZero() {
+		t.Errorf("the relative only band should be kept, got %+v", band)
+	}
+}
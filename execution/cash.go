@@ -0,0 +1,105 @@
+package execution
+
+import (
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// spendCash limits the buys by the cash of their quote currencies plus the proceeds of the sells, the sells are
+// credited first and the buys are funded in their order. The cash is in the units of each quote currency, the
+// currency an order trades is debited or credited too if it's a quote currency itself. A reduced buy is truncated
+// by the step size of its market and dropped under the min quantity or the min notional.
+func spendCash(sells, buys []plannedOrder, cash map[string]fixedpoint.Value, markets map[string]types.Market) []types.SubmitOrder {
+	var submitOrders []types.SubmitOrder
+	for _, s := range sells {
+		cash[s.quote] = cash[s.quote].Add(s.order.Quantity.Mul(s.order.Price))
+		if amount, ok := cash[s.currency]; ok {
+			cash[s.currency] = fixedpoint.Max(amount.Sub(s.order.Quantity), fixedpoint.Zero)
+		}
+		submitOrders = append(submitOrders, s.order)
+	}
+
+	for _, b := range buys {
+		if b.order.Price.Sign() <= 0 {
+			submitOrders = append(submitOrders, b.order)
+			continue
+		}
+
+		available := fixedpoint.Max(cash[b.quote], fixedpoint.Zero)
+		if b.order.Quantity.Mul(b.order.Price).Compare(available) > 0 {
+			quantity := available.Div(b.order.Price)
+			market := markets[b.order.Symbol]
+			if market.StepSize.Sign() > 0 {
+				quantity = market.TruncateQuantity(quantity)
+			}
+
+			if quantity.Sign() <= 0 || quantity.Compare(market.MinQuantity) < 0 ||
+				(market.MinNotional.Sign() > 0 && quantity.Mul(b.order.Price).Compare(market.MinNotional) < 0) {
+				log.Infof("cash %v left for %s can not buy the min quantity, drop the buy", available, b.order.Symbol)
+				continue
+			}
+
+			log.Infof("reduce the buy quantity of %s from %v to %v by the cash %v", b.order.Symbol, b.order.Quantity, quantity, available)
+			b.order.Quantity = quantity
+		}
+
+		cash[b.quote] = available.Sub(b.order.Quantity.Mul(b.order.Price))
+
+		// the bought currency funds the later buys quoted in it, e.g. the BTC bought for ALTBTC
+		if amount, ok := cash[b.currency]; ok {
+			cash[b.currency] = amount.Add(b.order.Quantity)
+		}
+		submitOrders = append(submitOrders, b.order)
+	}
+	return submitOrders
+}
+
+// LimitBuys limits the buys by the cash keyed by the quote currency, e.g. the balances the trading session can
+// spend, plus the proceeds of the sells. The sells are returned first and the orders are not limited if cash is nil.
+func (p *Planner) LimitBuys(orders []types.SubmitOrder, cash map[string]fixedpoint.Value) []types.SubmitOrder {
+	if cash == nil {
+		return orders
+	}
+
+	var sells, buys []plannedOrder
+	for _, order := range orders {
+		market := p.Markets[order.Symbol]
+		o := plannedOrder{order: order, currency: market.BaseCurrency, quote: market.QuoteCurrency}
+		if order.Side == types.SideTypeSell {
+			sells = append(sells, o)
+		} else {
+			buys = append(buys, o)
+		}
+	}
+	return spendCash(sells, buys, cash, p.Markets)
+}
+
+// LimitSells caps the sells by the tradable quantities keyed by the currency, the currencies without a tradable
+// quantity, e.g. the shorts, are not capped and the orders capped to zero are dropped
+func (p *Planner) LimitSells(orders []types.SubmitOrder, tradable map[string]fixedpoint.Value) []types.SubmitOrder {
+	if len(tradable) == 0 {
+		return orders
+	}
+
+	var limited []types.SubmitOrder
+	for _, order := range orders {
+		currency := p.Markets[order.Symbol].BaseCurrency
+		if quantity, ok := tradable[currency]; ok && order.Side == types.SideTypeSell {
+			if order.Quantity.Compare(quantity) > 0 {
+				log.Infof("limit the sell quantity of %s from %s to the tradable %s %s",
+					order.Symbol,
+					order.Quantity.String(),
+					quantity.String(),
+					currency)
+				order.Quantity = quantity
+			}
+
+			if order.Quantity.Sign() <= 0 {
+				continue
+			}
+		}
+
+		limited = append(limited, order)
+	}
+	return limited
+}
@@ -0,0 +1,197 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// OrderExecutor manages the order lifecycle of the strategy: it submits the orders through the bbgo order executor,
+// so the risk controls and the order notifications apply, keeps the active orders in a LocalActiveOrderBook
+// per symbol and tracks the position of each symbol from the trades.
+type OrderExecutor struct {
+	session   *bbgo.ExchangeSession
+	submitter bbgo.OrderExecutor
+
+	mu           sync.Mutex
+	bound        bool
+	activeOrders map[string]*bbgo.LocalActiveOrderBook
+	orderStore   *bbgo.OrderStore
+	positions    map[string]*types.Position
+
+	tradeCallbacks []func(trade types.Trade)
+}
+
+// PositionStatus is a snapshot of the position of a symbol
+type PositionStatus struct {
+	Symbol      string           `json:"symbol"`
+	Base        fixedpoint.Value `json:"base"`
+	Quote       fixedpoint.Value `json:"quote"`
+	AverageCost fixedpoint.Value `json:"averageCost"`
+}
+
+// NewOrderExecutor creates an executor submitting the orders by submitter, the session order executor is used if it's nil
+func NewOrderExecutor(session *bbgo.ExchangeSession, submitter bbgo.OrderExecutor, symbols []string) *OrderExecutor {
+	if submitter == nil {
+		submitter = session.OrderExecutor
+	}
+
+	activeOrders := make(map[string]*bbgo.LocalActiveOrderBook)
+	positions := make(map[string]*types.Position)
+	for _, symbol := range symbols {
+		activeOrders[symbol] = bbgo.NewLocalActiveOrderBook(symbol)
+		if market, ok := session.Market(symbol); ok {
+			positions[symbol] = types.NewPositionFromMarket(market)
+		}
+	}
+
+	orderStore := bbgo.NewOrderStore("")
+	orderStore.RemoveCancelled = true
+
+	return &OrderExecutor{
+		session:      session,
+		submitter:    submitter,
+		activeOrders: activeOrders,
+		orderStore:   orderStore,
+		positions:    positions,
+	}
+}
+
+func (e *OrderExecutor) BindStream() {
+	e.mu.Lock()
+	e.bound = true
+	for _, book := range e.activeOrders {
+		book.BindStream(e.session.UserDataStream)
+	}
+	e.mu.Unlock()
+
+	e.orderStore.BindStream(e.session.UserDataStream)
+
+	e.session.UserDataStream.OnTradeUpdate(func(trade types.Trade) {
+		if !e.orderStore.Exists(trade.OrderID) {
+			return
+		}
+
+		e.emitTrade(trade)
+	})
+}
+
+// OnTrade registers a callback for the trades of the orders submitted by the executor
+func (e *OrderExecutor) OnTrade(cb func(trade types.Trade)) {
+	e.tradeCallbacks = append(e.tradeCallbacks, cb)
+}
+
+// Attach tracks the orders submitted before, e.g. the open orders of a cycle resumed after a restart
+func (e *OrderExecutor) Attach(orders ...types.Order) {
+	e.orderStore.Add(orders...)
+	e.addActiveOrders(orders...)
+}
+
+// activeOrderBook returns the active order book of the symbol, the book is created if the symbol was not given
+// to NewOrderExecutor
+func (e *OrderExecutor) activeOrderBook(symbol string) *bbgo.LocalActiveOrderBook {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	book, ok := e.activeOrders[symbol]
+	if !ok {
+		book = bbgo.NewLocalActiveOrderBook(symbol)
+		if e.bound {
+			book.BindStream(e.session.UserDataStream)
+		}
+		e.activeOrders[symbol] = book
+	}
+	return book
+}
+
+func (e *OrderExecutor) addActiveOrders(orders ...types.Order) {
+	for _, order := range orders {
+		e.activeOrderBook(order.Symbol).Add(order)
+	}
+}
+
+func (e *OrderExecutor) emitTrade(trade types.Trade) {
+	e.mu.Lock()
+	if position, ok := e.positions[trade.Symbol]; ok {
+		position.AddTrade(trade)
+	}
+	e.mu.Unlock()
+
+	for _, cb := range e.tradeCallbacks {
+		cb(trade)
+	}
+}
+
+func (e *OrderExecutor) SubmitOrders(ctx context.Context, submitOrders ...types.SubmitOrder) (types.OrderSlice, error) {
+	for i, order := range submitOrders {
+		if market, ok := e.session.Market(order.Symbol); ok {
+			submitOrders[i].Market = market
+		}
+	}
+
+	createdOrders, err := e.submitter.SubmitOrders(ctx, submitOrders...)
+	if len(createdOrders) > 0 {
+		e.orderStore.Add(createdOrders...)
+		e.addActiveOrders(createdOrders...)
+	}
+	return createdOrders, err
+}
+
+// GracefulCancel cancels the active orders of every symbol and waits until the cancellations are confirmed,
+// it returns an error if some orders are still open when ctx is done
+func (e *OrderExecutor) GracefulCancel(ctx context.Context) error {
+	e.mu.Lock()
+	symbols := make([]string, 0, len(e.activeOrders))
+	for symbol := range e.activeOrders {
+		symbols = append(symbols, symbol)
+	}
+	e.mu.Unlock()
+	sort.Strings(symbols)
+
+	var open []string
+	for _, symbol := range symbols {
+		book := e.activeOrderBook(symbol)
+		if book.NumOfOrders() == 0 {
+			continue
+		}
+
+		if err := book.GracefulCancel(ctx, e.session.Exchange); err != nil {
+			return err
+		}
+
+		if n := book.NumOfOrders(); n > 0 {
+			open = append(open, fmt.Sprintf("%s: %d", symbol, n))
+		}
+	}
+
+	if len(open) > 0 {
+		return fmt.Errorf("orders are still open after the cancellation: %s", strings.Join(open, ", "))
+	}
+	return nil
+}
+
+// Positions returns the positions of the symbols sorted by the symbol
+func (e *OrderExecutor) Positions() []PositionStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	positions := make([]PositionStatus, 0, len(e.positions))
+	for symbol, position := range e.positions {
+		positions = append(positions, PositionStatus{
+			Symbol:      symbol,
+			Base:        position.Base,
+			Quote:       position.Quote,
+			AverageCost: position.AverageCost,
+		})
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Symbol < positions[j].Symbol
+	})
+	return positions
+}
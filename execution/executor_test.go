@@ -0,0 +1,107 @@
+package execution
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// fakeExchange records the cancelled orders and confirms them on the stream if confirm is set
+type fakeExchange struct {
+	types.Exchange
+
+	stream    *types.StandardStream
+	confirm   bool
+	cancelled map[string]int
+}
+
+func (e *fakeExchange) Name() types.ExchangeName {
+	return types.ExchangeBinance
+}
+
+func (e *fakeExchange) NewStream() types.Stream {
+	return e.stream
+}
+
+func (e *fakeExchange) CancelOrders(ctx context.Context, orders ...types.Order) error {
+	for _, order := range orders {
+		e.cancelled[order.Symbol]++
+		if e.confirm {
+			order.Status = types.OrderStatusCanceled
+			go e.stream.EmitOrderUpdate(order)
+		}
+	}
+	return nil
+}
+
+func (e *fakeExchange) QueryOpenOrders(ctx context.Context, symbol string) ([]types.Order, error) {
+	return nil, ctx.Err()
+}
+
+// fakeSubmitter creates the submitted orders as new orders
+type fakeSubmitter struct {
+	bbgo.OrderExecutor
+
+	orderID uint64
+}
+
+func (s *fakeSubmitter) SubmitOrders(ctx context.Context, orders ...types.SubmitOrder) (types.OrderSlice, error) {
+	var createdOrders types.OrderSlice
+	for _, order := range orders {
+		s.orderID++
+		createdOrders = append(createdOrders, types.Order{
+			SubmitOrder: order,
+			OrderID:     s.orderID,
+			Status:      types.OrderStatusNew,
+		})
+	}
+	return createdOrders, nil
+}
+
+func newTestExecutor(confirm bool) (*OrderExecutor, *fakeExchange) {
+	exchange := &fakeExchange{stream: &types.StandardStream{}, confirm: confirm, cancelled: make(map[string]int)}
+	session := bbgo.NewExchangeSession("test", exchange)
+	executor := NewOrderExecutor(session, &fakeSubmitter{}, []string{"BTCUSDT", "ETHUSDT"})
+	executor.BindStream()
+
+	_, err := executor.SubmitOrders(context.Background(),
+		types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Type: types.OrderTypeLimit, Quantity: number(1), Price: number(100)},
+		types.SubmitOrder{Symbol: "ETHUSDT", Side: types.SideTypeSell, Type: types.OrderTypeLimit, Quantity: number(2), Price: number(10)},
+		types.SubmitOrder{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Type: types.OrderTypeLimit, Quantity: number(3), Price: number(9)})
+	if err != nil {
+		panic(err)
+	}
+	return executor, exchange
+}
+
+func TestGracefulCancel(t *testing.T) {
+	executor, exchange := newTestExecutor(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := executor.GracefulCancel(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if exchange.cancelled["BTCUSDT"] != 1 || exchange.cancelled["ETHUSDT"] != 2 {
+		t.Errorf("got cancelled orders %v, want BTCUSDT: 1, ETHUSDT: 2", exchange.cancelled)
+	}
+}
+
+func TestGracefulCancelOrdersLeft(t *testing.T) {
+	executor, _ := newTestExecutor(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := executor.GracefulCancel(ctx)
+	if err == nil {
+		t.Fatal("expected an error with the orders left")
+	}
+	if !strings.Contains(err.Error(), "BTCUSDT: 1") || !strings.Contains(err.Error(), "ETHUSDT: 2") {
+		t.Errorf("got error %q, want the open orders of both symbols", err)
+	}
+}
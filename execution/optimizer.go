@@ -0,0 +1,86 @@
+package execution
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// Optimizer reduces the trades of a rebalance instead of trading every breached asset to its target:
+// the breached weights are only brought back into their bands, the orders under the min notional of their
+// markets are raised if it keeps the weight in the band and the order within the max amount or dropped
+// otherwise, and the buys are limited by the available cash with the largest drifts funded first.
+// It's a greedy heuristic order by order, it does not search for the set of orders with the least turnover.
+type Optimizer struct {
+	// Pull is how far into the band a breached weight is brought back, 0 stops at the band edge and 1 goes to the target
+	Pull fixedpoint.Value `json:"pull"`
+}
+
+func (o *Optimizer) Validate() error {
+	if o.Pull.Sign() < 0 || o.Pull.Compare(fixedpoint.One) > 0 {
+		return fmt.Errorf("optimizer.pull should be between 0 and 1")
+	}
+	return nil
+}
+
+// difference returns the part of the weight difference to trade, the breached weight stops
+// at Pull of the way from the band edge to the target
+func (o *Optimizer) difference(weightDifference, threshold fixedpoint.Value) fixedpoint.Value {
+	keep := threshold.Mul(fixedpoint.One.Sub(o.Pull))
+	if weightDifference.Sign() > 0 {
+		return fixedpoint.Max(weightDifference.Sub(keep), fixedpoint.Zero)
+	}
+	return fixedpoint.Min(weightDifference.Add(keep), fixedpoint.Zero)
+}
+
+// fitMinNotional raises the quantity to the min notional of the market if it does not exceed maxQuantity,
+// which is bounded by the band and the max amount, false is returned if the order should be dropped
+func (o *Optimizer) fitMinNotional(market types.Market, quantity, price, maxQuantity fixedpoint.Value) (fixedpoint.Value, bool) {
+	if market.MinNotional.Sign() <= 0 || price.Sign() <= 0 || quantity.Mul(price).Compare(market.MinNotional) >= 0 {
+		return quantity, true
+	}
+
+	minQuantity := market.MinNotional.Div(price)
+	if minQuantity.Compare(maxQuantity) > 0 {
+		return quantity, false
+	}
+	return minQuantity, true
+}
+
+type plannedOrder struct {
+	order types.SubmitOrder
+	// basePrice is the price of the order symbol in the base currency
+	basePrice fixedpoint.Value
+	// drift is the absolute weight difference to the target
+	drift fixedpoint.Value
+	// currency is the asset the order trades
+	currency string
+	// quote is the target currency the symbol is quoted in, empty if it's quoted in the base currency
+	quote string
+}
+
+// fitCash limits the buys by the cash of their quote currencies plus the sell proceeds, the buys of the largest
+// drifts are funded first. The cash is in the units of each quote currency and the cash of the base currency is
+// keyed by "". The buys quoted in the base currency go first, since they fund the buys quoted in the other target
+// currencies.
+func (o *Optimizer) fitCash(orders []plannedOrder, cash map[string]fixedpoint.Value, markets map[string]types.Market) []types.SubmitOrder {
+	var sells, buys []plannedOrder
+	for _, order := range orders {
+		if order.order.Side == types.SideTypeSell {
+			sells = append(sells, order)
+		} else {
+			buys = append(buys, order)
+		}
+	}
+
+	sort.SliceStable(buys, func(i, j int) bool {
+		if (len(buys[i].quote) == 0) != (len(buys[j].quote) == 0) {
+			return len(buys[i].quote) == 0
+		}
+		return buys[i].drift.Compare(buys[j].drift) > 0
+	})
+
+	return spendCash(sells, buys, cash, markets)
+}
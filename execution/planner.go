@@ -0,0 +1,385 @@
+package execution
+
+import (
+	"sort"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+var log = logrus.WithFields(logrus.Fields{"strategy": "marketcap", "component": "execution"})
+
+// Planner generates the orders that move the current weights to the target weights
+type Planner struct {
+	// Threshold is the minimal weight difference to trade
+	Threshold fixedpoint.Value
+	// Band replaces Threshold with the tolerance band of each target weight if it's set
+	Band *Band
+	// ThresholdAmount is the minimal value difference in the base currency to trade, disabled if it's zero
+	ThresholdAmount fixedpoint.Value
+	// MaxAmount is the max amount to buy or sell per order, no limit if it's zero
+	MaxAmount fixedpoint.Value
+	// GroupID is set on every generated order
+	GroupID uint32
+
+	// Optimizer minimizes the trades if it's set, Markets provides the min notional of the symbols to it
+	Optimizer *Optimizer
+	Markets   map[string]types.Market
+}
+
+// Plan generates the submit orders of the symbols, the vectors are ordered as the symbols with the base currency
+// appended. The prices are in the base currency and the symbol prices, used as the order prices, are in the quote
+// currencies of the symbols, they are the same unless a symbol is quoted in another currency.
+func (p *Planner) Plan(symbols []string, prices, symbolPrices, marketValues, targetWeights vector.Vector) (submitOrders []types.SubmitOrder) {
+	currentWeights := marketValues.Normalize()
+	totalValue := marketValues.Sum()
+	indexes := p.currencyIndexes(symbols)
+
+	// maxQuantities bound the raise to the min notional, the weight should stay in the band on the other side of the target
+	maxQuantities := vector.New(len(symbols))
+
+	var plannedOrders []plannedOrder
+	for i, symbol := range symbols {
+		currentWeight := currentWeights[i]
+		currentPrice := prices[i]
+		targetWeight := targetWeights[i]
+
+		log.Infof("%s price: %v, current weight: %v, target weight: %v",
+			symbol,
+			currentPrice,
+			currentWeight,
+			targetWeight)
+
+		// calculate the difference between current weight and target weight
+		// if the difference is less than threshold, then we will not create the order
+		weightDifference := targetWeight.Sub(currentWeight)
+		threshold := p.Threshold
+		if p.Band != nil {
+			threshold = p.Band.Threshold(targetWeight)
+		}
+
+		if currentPrice.Sign() > 0 {
+			maxQuantities[i] = weightDifference.Abs().Add(threshold).Mul(totalValue).Div(currentPrice)
+		}
+
+		if weightDifference.Abs().Compare(threshold) < 0 {
+			log.Infof("%s weight distance |%v - %v| = |%v| less than the threshold: %v",
+				symbol,
+				currentWeight,
+				targetWeight,
+				weightDifference,
+				threshold)
+			continue
+		}
+
+		drift := weightDifference.Abs()
+		if p.Optimizer != nil {
+			weightDifference = p.Optimizer.difference(weightDifference, threshold)
+		}
+
+		// the value difference of small portfolios can be too small to trade even if the weight drifts far
+		valueDifference := weightDifference.Mul(totalValue)
+		if p.ThresholdAmount.Sign() > 0 && valueDifference.Abs().Compare(p.ThresholdAmount) < 0 {
+			log.Infof("%s value distance |%v| less than the threshold amount: %v",
+				symbol,
+				valueDifference,
+				p.ThresholdAmount)
+			continue
+		}
+
+		quantity := valueDifference.Div(currentPrice)
+
+		side := types.SideTypeBuy
+		if quantity.Sign() < 0 {
+			side = types.SideTypeSell
+			quantity = quantity.Abs()
+		}
+
+		var ok bool
+		quantity, ok = p.limitQuantity(symbol, side, quantity, currentPrice, symbolPrices[i], maxQuantities[i])
+		if !ok {
+			continue
+		}
+
+		order := types.SubmitOrder{
+			Symbol:   symbol,
+			Side:     side,
+			Type:     types.OrderTypeLimit,
+			Quantity: quantity,
+			Price:    symbolPrices[i],
+			GroupID:  p.GroupID,
+		}
+
+		plannedOrders = append(plannedOrders, p.plannedOrder(order, currentPrice, drift, indexes))
+	}
+
+	plannedOrders = p.fundQuoteCurrencies(symbols, prices, symbolPrices, maxQuantities, plannedOrders, indexes)
+
+	if p.Optimizer != nil {
+		// the cash of the base currency is the last element, the cash of a quote currency is its quantity
+		cash := map[string]fixedpoint.Value{"": marketValues[len(marketValues)-1]}
+		for _, o := range plannedOrders {
+			if i := indexes[o.quote]; len(o.quote) > 0 && prices[i].Sign() > 0 {
+				cash[o.quote] = marketValues[i].Div(prices[i])
+			}
+		}
+		return p.Optimizer.fitCash(plannedOrders, cash, p.Markets)
+	}
+
+	return fundedOrders(plannedOrders)
+}
+
+// PlanContribution generates buy-only orders that deploy amount of the base currency across the symbols
+// in proportion to their positive target weights, the base currency weight (the last element) is excluded.
+// The symbols quoted in another target currency are funded by buying that currency with the base currency.
+func (p *Planner) PlanContribution(symbols []string, prices, symbolPrices, targetWeights vector.Vector, amount fixedpoint.Value) (submitOrders []types.SubmitOrder) {
+	indexes := p.currencyIndexes(symbols)
+
+	weights := vector.New(len(symbols))
+	for i := range symbols {
+		weights[i] = fixedpoint.Max(targetWeights[i], fixedpoint.Zero)
+	}
+	weights = weights.Normalize()
+
+	var plannedOrders []plannedOrder
+	for i, symbol := range symbols {
+		if weights[i].Sign() <= 0 || prices[i].Sign() <= 0 {
+			continue
+		}
+
+		currentPrice := prices[i]
+		quantity := amount.Mul(weights[i]).Div(currentPrice)
+
+		if p.MaxAmount.Sign() > 0 {
+			quantity = bbgo.AdjustQuantityByMaxAmount(quantity, currentPrice, p.MaxAmount)
+		}
+
+		log.Infof("contribute %s to %s: buy %s @ %s", amount.Mul(weights[i]).String(), symbol, quantity.String(), currentPrice.String())
+
+		order := types.SubmitOrder{
+			Symbol:   symbol,
+			Side:     types.SideTypeBuy,
+			Type:     types.OrderTypeLimit,
+			Quantity: quantity,
+			Price:    symbolPrices[i],
+			GroupID:  p.GroupID,
+		}
+		plannedOrders = append(plannedOrders, p.plannedOrder(order, currentPrice, weights[i], indexes))
+	}
+
+	return fundedOrders(p.fundQuoteCurrencies(symbols, prices, symbolPrices, nil, plannedOrders, indexes))
+}
+
+// MergeOrders nets the contribution buys with the rebalance orders of the same symbols
+func (p *Planner) MergeOrders(orders, contributionOrders []types.SubmitOrder) []types.SubmitOrder {
+	merged := append([]types.SubmitOrder{}, orders...)
+
+	for _, contribution := range contributionOrders {
+		i := 0
+		for ; i < len(merged); i++ {
+			if merged[i].Symbol == contribution.Symbol {
+				break
+			}
+		}
+
+		if i == len(merged) {
+			merged = append(merged, contribution)
+			continue
+		}
+
+		order := &merged[i]
+		if order.Side == contribution.Side {
+			order.Quantity = order.Quantity.Add(contribution.Quantity)
+			continue
+		}
+
+		if net := order.Quantity.Sub(contribution.Quantity); net.Sign() >= 0 {
+			order.Quantity = net
+		} else {
+			order.Side = contribution.Side
+			order.Quantity = net.Neg()
+		}
+	}
+
+	var netted []types.SubmitOrder
+	for _, order := range merged {
+		if order.Quantity.Sign() > 0 {
+			netted = append(netted, order)
+		}
+	}
+	return netted
+}
+
+// currencyIndexes returns the index of the symbol of each target currency, to tell the symbols quoted in
+// another target currency, e.g. ALTBTC, from the symbols quoted in the base currency
+func (p *Planner) currencyIndexes(symbols []string) map[string]int {
+	indexes := make(map[string]int, len(symbols))
+	for i, symbol := range symbols {
+		if market, ok := p.Markets[symbol]; ok {
+			indexes[market.BaseCurrency] = i
+		}
+	}
+	return indexes
+}
+
+func (p *Planner) plannedOrder(order types.SubmitOrder, basePrice, drift fixedpoint.Value, indexes map[string]int) plannedOrder {
+	o := plannedOrder{
+		order:     order,
+		basePrice: basePrice,
+		drift:     drift,
+	}
+
+	if market, ok := p.Markets[order.Symbol]; ok {
+		o.currency = market.BaseCurrency
+		if _, ok := indexes[market.QuoteCurrency]; ok {
+			o.quote = market.QuoteCurrency
+		}
+	}
+	return o
+}
+
+// limitQuantity applies the max amount to the quantity, and with the optimizer raises it to the min notional of the
+// market if it does not exceed maxQuantity, false is returned if the order should be dropped
+func (p *Planner) limitQuantity(symbol string, side types.SideType, quantity, price, symbolPrice, maxQuantity fixedpoint.Value) (fixedpoint.Value, bool) {
+	if p.MaxAmount.Sign() > 0 {
+		quantity = bbgo.AdjustQuantityByMaxAmount(quantity, price, p.MaxAmount)
+		log.Infof("adjust the quantity %v (%s %s @ %v) by max amount %v",
+			quantity,
+			symbol,
+			side.String(),
+			price,
+			p.MaxAmount)
+	}
+
+	if p.Optimizer == nil {
+		return quantity, true
+	}
+
+	if p.MaxAmount.Sign() > 0 {
+		maxQuantity = fixedpoint.Min(maxQuantity, p.MaxAmount.Div(price))
+	}
+
+	quantity, ok := p.Optimizer.fitMinNotional(p.Markets[symbol], quantity, symbolPrice, maxQuantity)
+	if !ok {
+		log.Infof("optimizer: %s %s %v is under the min notional, drop it", symbol, side, quantity)
+	}
+	return quantity, ok
+}
+
+// fundQuoteCurrencies adjusts the orders of the target currencies the other symbols are quoted in: the BTC spent
+// by the ALTBTC buys is bought with the base currency and the BTC received by the sells is sold, so the weight
+// of BTC still reaches its target. Only one level of quoting is funded. The funding orders are limited by the max
+// amount, and raised to the min notional within maxQuantities unless they are nil.
+func (p *Planner) fundQuoteCurrencies(symbols []string, prices, symbolPrices, maxQuantities vector.Vector, orders []plannedOrder, indexes map[string]int) []plannedOrder {
+	flows := make(map[string]fixedpoint.Value)
+	drifts := make(map[string]fixedpoint.Value)
+	var quotes []string
+	for _, o := range orders {
+		if len(o.quote) == 0 {
+			continue
+		}
+
+		if _, ok := flows[o.quote]; !ok {
+			quotes = append(quotes, o.quote)
+		}
+
+		amount := o.order.Quantity.Mul(o.basePrice)
+		if o.order.Side == types.SideTypeSell {
+			amount = amount.Neg()
+		}
+		flows[o.quote] = flows[o.quote].Add(amount)
+		drifts[o.quote] = fixedpoint.Max(drifts[o.quote], o.drift)
+	}
+
+	for _, quote := range quotes {
+		i := indexes[quote]
+		if flows[quote].IsZero() || prices[i].Sign() <= 0 {
+			continue
+		}
+
+		quantity := flows[quote].Div(prices[i])
+		log.Infof("fund the orders quoted in %s: %s %s %s", quote, symbols[i], sideOf(quantity), quantity.Abs().String())
+
+		j := 0
+		for ; j < len(orders); j++ {
+			if orders[j].order.Symbol == symbols[i] {
+				break
+			}
+		}
+
+		if j == len(orders) {
+			order := types.SubmitOrder{
+				Symbol:  symbols[i],
+				Type:    types.OrderTypeLimit,
+				Price:   symbolPrices[i],
+				GroupID: p.GroupID,
+			}
+			orders = append(orders, p.plannedOrder(order, prices[i], drifts[quote], indexes))
+		} else if orders[j].order.Side == types.SideTypeSell {
+			quantity = quantity.Sub(orders[j].order.Quantity)
+		} else {
+			quantity = quantity.Add(orders[j].order.Quantity)
+		}
+
+		o := &orders[j]
+		o.order.Side = sideOf(quantity)
+		o.drift = fixedpoint.Max(o.drift, drifts[quote])
+
+		// the funding creates or changes the order after the limits of the plan, so they are applied again
+		limited, ok := quantity.Abs(), true
+		if maxQuantities != nil {
+			limited, ok = p.limitQuantity(symbols[i], o.order.Side, limited, prices[i], symbolPrices[i], maxQuantities[i])
+		} else if p.MaxAmount.Sign() > 0 {
+			limited = bbgo.AdjustQuantityByMaxAmount(limited, prices[i], p.MaxAmount)
+		}
+
+		if !ok {
+			limited = fixedpoint.Zero
+		}
+		o.order.Quantity = limited
+	}
+
+	var funded []plannedOrder
+	for _, o := range orders {
+		if o.order.Quantity.Sign() > 0 {
+			funded = append(funded, o)
+		}
+	}
+	return funded
+}
+
+// fundedOrders returns the orders in the order of the submission: the sells, then the buys quoted in the base
+// currency, which fund the buys quoted in the other currencies
+func fundedOrders(orders []plannedOrder) (submitOrders []types.SubmitOrder) {
+	rank := func(o plannedOrder) int {
+		switch {
+		case o.order.Side == types.SideTypeSell:
+			return 0
+		case len(o.quote) == 0:
+			return 1
+		}
+		return 2
+	}
+
+	sorted := append([]plannedOrder{}, orders...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+
+	for _, o := range sorted {
+		submitOrders = append(submitOrders, o.order)
+	}
+	return submitOrders
+}
+
+func sideOf(quantity fixedpoint.Value) types.SideType {
+	if quantity.Sign() < 0 {
+		return types.SideTypeSell
+	}
+	return types.SideTypeBuy
+}
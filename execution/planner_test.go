@@ -0,0 +1,276 @@
+package execution
+
+import (
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+func number(f float64) fixedpoint.Value {
+	return fixedpoint.NewFromFloat(f)
+}
+
+func checkOrders(t *testing.T, orders []types.SubmitOrder, want []types.SubmitOrder) {
+	t.Helper()
+
+	if len(orders) != len(want) {
+		t.Fatalf("got %d orders %v, want %d", len(orders), orders, len(want))
+	}
+
+	for i := range want {
+		if orders[i].Symbol != want[i].Symbol || orders[i].Side != want[i].Side || orders[i].Quantity.Compare(want[i].Quantity) != 0 {
+			t.Errorf("order %d = %s %s %s, want %s %s %s", i,
+				orders[i].Symbol, orders[i].Side, orders[i].Quantity.String(),
+				want[i].Symbol, want[i].Side, want[i].Quantity.String())
+		}
+	}
+}
+
+func TestPlanThresholdAmount(t *testing.T) {
+	symbols := []string{"BTCUSDT", "ETHUSDT"}
+	prices := vector.Vector{number(100), number(10), number(1)}
+	marketValues := vector.Vector{number(400), number(500), number(100)}
+	targetWeights := vector.Vector{number(0.45), number(0.48), number(0.07)}
+
+	// both weights drift beyond the threshold, the sell goes first to fund the buy
+	planner := &Planner{Threshold: number(0.01)}
+	checkOrders(t, planner.Plan(symbols, prices, prices, marketValues, targetWeights), []types.SubmitOrder{
+		{Symbol: "ETHUSDT", Side: types.SideTypeSell, Quantity: number(2)},
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(0.5)},
+	})
+
+	// the ETH difference is worth 20, less than the threshold amount
+	planner.ThresholdAmount = number(30)
+	checkOrders(t, planner.Plan(symbols, prices, prices, marketValues, targetWeights), []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(0.5)},
+	})
+}
+
+var crossQuotedMarkets = map[string]types.Market{
+	"BTCUSDT": {Symbol: "BTCUSDT", BaseCurrency: "BTC", QuoteCurrency: "USDT"},
+	"ALTBTC":  {Symbol: "ALTBTC", BaseCurrency: "ALT", QuoteCurrency: "BTC"},
+}
+
+func TestPlanFundsQuoteCurrency(t *testing.T) {
+	planner := &Planner{Threshold: number(0.01), Markets: crossQuotedMarkets}
+
+	symbols := []string{"BTCUSDT", "ALTBTC"}
+	prices := vector.Vector{number(100), number(10), number(1)}
+	symbolPrices := vector.Vector{number(100), number(0.1), number(1)}
+	marketValues := vector.Vector{number(50), number(0), number(50)}
+	targetWeights := vector.Vector{number(0.5), number(0.3), number(0.2)}
+
+	// the BTC spent on ALTBTC is bought with the base currency first, so BTC stays at its target
+	checkOrders(t, planner.Plan(symbols, prices, symbolPrices, marketValues, targetWeights), []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(0.3)},
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(3)},
+	})
+}
+
+func TestPlanNetsQuoteCurrency(t *testing.T) {
+	planner := &Planner{Threshold: number(0.01), Markets: crossQuotedMarkets}
+
+	symbols := []string{"BTCUSDT", "ALTBTC"}
+	prices := vector.Vector{number(100), number(10), number(1)}
+	symbolPrices := vector.Vector{number(100), number(0.1), number(1)}
+	marketValues := vector.Vector{number(80), number(0), number(20)}
+	targetWeights := vector.Vector{number(0.5), number(0.3), number(0.2)}
+
+	// BTC is overweight by 30, which funds the ALTBTC buy instead of being sold
+	checkOrders(t, planner.Plan(symbols, prices, symbolPrices, marketValues, targetWeights), []types.SubmitOrder{
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(3)},
+	})
+}
+
+func TestPlanFundingMaxAmount(t *testing.T) {
+	planner := &Planner{Threshold: number(0.01), Markets: crossQuotedMarkets, MaxAmount: number(20)}
+
+	symbols := []string{"BTCUSDT", "ALTBTC"}
+	prices := vector.Vector{number(100), number(10), number(1)}
+	symbolPrices := vector.Vector{number(100), number(0.1), number(1)}
+	marketValues := vector.Vector{number(30), number(0), number(70)}
+	targetWeights := vector.Vector{number(0.5), number(0.4), number(0.1)}
+
+	// the ALT buy of 40 is capped to 20, the BTC buy of 20 plus its funding is capped by the max amount again
+	checkOrders(t, planner.Plan(symbols, prices, symbolPrices, marketValues, targetWeights), []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(0.2)},
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(2)},
+	})
+}
+
+func TestPlanFundingMinNotional(t *testing.T) {
+	markets := map[string]types.Market{
+		"BTCUSDT": {Symbol: "BTCUSDT", BaseCurrency: "BTC", QuoteCurrency: "USDT", MinNotional: number(10)},
+		"ALTBTC":  {Symbol: "ALTBTC", BaseCurrency: "ALT", QuoteCurrency: "BTC"},
+	}
+	planner := &Planner{Threshold: number(0.01), Markets: markets, Optimizer: &Optimizer{Pull: fixedpoint.One}}
+
+	symbols := []string{"BTCUSDT", "ALTBTC"}
+	prices := vector.Vector{number(100), number(10), number(1)}
+	symbolPrices := vector.Vector{number(100), number(0.1), number(1)}
+	marketValues := vector.Vector{number(50), number(0), number(50)}
+	targetWeights := vector.Vector{number(0.5), number(0.05), number(0.45)}
+
+	// the BTC funding of 5 is under the min notional and can not be raised within the band of BTC,
+	// so it's dropped and the ALT is bought with the BTC held
+	checkOrders(t, planner.Plan(symbols, prices, symbolPrices, marketValues, targetWeights), []types.SubmitOrder{
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(0.5)},
+	})
+}
+
+func TestPlanContributionFundsQuoteCurrency(t *testing.T) {
+	planner := &Planner{Markets: crossQuotedMarkets}
+
+	symbols := []string{"BTCUSDT", "ALTBTC"}
+	prices := vector.Vector{number(100), number(10), number(1)}
+	symbolPrices := vector.Vector{number(100), number(0.1), number(1)}
+	targetWeights := vector.Vector{number(0.5), number(0.5), number(0)}
+
+	checkOrders(t, planner.PlanContribution(symbols, prices, symbolPrices, targetWeights, number(100)), []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(1)},
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(5)},
+	})
+}
+
+func TestFitCashPerQuoteCurrency(t *testing.T) {
+	planner := &Planner{Threshold: number(0.01), Markets: crossQuotedMarkets, Optimizer: &Optimizer{Pull: fixedpoint.One}}
+
+	symbols := []string{"BTCUSDT", "ALTBTC"}
+	prices := vector.Vector{number(100), number(10), number(1)}
+	symbolPrices := vector.Vector{number(100), number(0.1), number(1)}
+	marketValues := vector.Vector{number(50), number(0), number(50)}
+	targetWeights := vector.Vector{number(0.5), number(0.3), number(0.2)}
+
+	checkOrders(t, planner.Plan(symbols, prices, symbolPrices, marketValues, targetWeights), []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(0.3)},
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(3)},
+	})
+}
+
+func TestFitMinNotionalWithinMaxAmount(t *testing.T) {
+	markets := map[string]types.Market{
+		"BTCUSDT": {Symbol: "BTCUSDT", BaseCurrency: "BTC", QuoteCurrency: "USDT", MinNotional: number(25)},
+	}
+
+	symbols := []string{"BTCUSDT"}
+	prices := vector.Vector{number(100), number(1)}
+	marketValues := vector.Vector{number(480), number(520)}
+	targetWeights := vector.Vector{number(0.5), number(0.5)}
+
+	// the buy of 20 is raised to the min notional of 25
+	planner := &Planner{Threshold: number(0.01), Markets: markets, Optimizer: &Optimizer{Pull: fixedpoint.One}}
+	checkOrders(t, planner.Plan(symbols, prices, prices, marketValues, targetWeights), []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(0.25)},
+	})
+
+	// the min notional exceeds the max amount, the order is dropped instead of raised beyond it
+	planner.MaxAmount = number(22)
+	checkOrders(t, planner.Plan(symbols, prices, prices, marketValues, targetWeights), nil)
+}
+
+func TestMergeOrders(t *testing.T) {
+	orders := []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeSell, Quantity: number(0.5)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: number(1)},
+		{Symbol: "BNBUSDT", Side: types.SideTypeSell, Quantity: number(1)},
+	}
+	contribution := []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(0.2)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: number(2)},
+		{Symbol: "BNBUSDT", Side: types.SideTypeBuy, Quantity: number(1)},
+		{Symbol: "ADAUSDT", Side: types.SideTypeBuy, Quantity: number(10)},
+	}
+
+	merged := (&Planner{}).MergeOrders(orders, contribution)
+
+	want := []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeSell, Quantity: number(0.3)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: number(3)},
+		{Symbol: "ADAUSDT", Side: types.SideTypeBuy, Quantity: number(10)},
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("merged %d orders, want %d", len(merged), len(want))
+	}
+	for i := range want {
+		if merged[i].Symbol != want[i].Symbol || merged[i].Side != want[i].Side || merged[i].Quantity.Compare(want[i].Quantity) != 0 {
+			t.Errorf("order %d = %s %s %s, want %s %s %s", i,
+				merged[i].Symbol, merged[i].Side, merged[i].Quantity.String(),
+				want[i].Symbol, want[i].Side, want[i].Quantity.String())
+		}
+	}
+
+	if orders[0].Quantity.Compare(number(0.5)) != 0 {
+		t.Errorf("the rebalance orders should not be modified")
+	}
+}
+
+func TestLimitBuys(t *testing.T) {
+	planner := &Planner{Markets: map[string]types.Market{
+		"BTCUSDT": {Symbol: "BTCUSDT", BaseCurrency: "BTC", QuoteCurrency: "USDT"},
+		"ETHUSDT": {Symbol: "ETHUSDT", BaseCurrency: "ETH", QuoteCurrency: "USDT", StepSize: number(1), MinQuantity: number(1)},
+		"ALTBTC":  {Symbol: "ALTBTC", BaseCurrency: "ALT", QuoteCurrency: "BTC"},
+	}}
+
+	orders := []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(1), Price: number(100)},
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(20), Price: number(0.1)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: number(3), Price: number(10)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeSell, Quantity: number(3), Price: number(10)},
+	}
+
+	// the proceeds of the sell fund the buys quoted in USDT and the BTC bought funds the ALT
+	cash := map[string]fixedpoint.Value{"USDT": number(100), "BTC": number(1)}
+	checkOrders(t, planner.LimitBuys(orders, cash), []types.SubmitOrder{
+		{Symbol: "ETHUSDT", Side: types.SideTypeSell, Quantity: number(3)},
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(1)},
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(20)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: number(3)},
+	})
+
+	// only the BTC bought funds the ALT, and the 23.5 USDT left buys 2.35 ETH truncated to 2 by the step size
+	cash = map[string]fixedpoint.Value{"USDT": number(93.5), "BTC": number(0)}
+	checkOrders(t, planner.LimitBuys(orders, cash), []types.SubmitOrder{
+		{Symbol: "ETHUSDT", Side: types.SideTypeSell, Quantity: number(3)},
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(1)},
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(10)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: number(2)},
+	})
+
+	// the 4 USDT left can not buy the min quantity of ETH
+	cash = map[string]fixedpoint.Value{"USDT": number(74), "BTC": number(0)}
+	checkOrders(t, planner.LimitBuys(orders, cash), []types.SubmitOrder{
+		{Symbol: "ETHUSDT", Side: types.SideTypeSell, Quantity: number(3)},
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(1)},
+		{Symbol: "ALTBTC", Side: types.SideTypeBuy, Quantity: number(10)},
+	})
+
+	if limited := planner.LimitBuys(orders, nil); len(limited) != len(orders) {
+		t.Errorf("the orders should not be limited without the cash, got %v", limited)
+	}
+}
+
+func TestLimitSells(t *testing.T) {
+	planner := &Planner{Markets: map[string]types.Market{
+		"BTCUSDT": {Symbol: "BTCUSDT", BaseCurrency: "BTC", QuoteCurrency: "USDT"},
+		"ETHUSDT": {Symbol: "ETHUSDT", BaseCurrency: "ETH", QuoteCurrency: "USDT"},
+		"SOLUSDT": {Symbol: "SOLUSDT", BaseCurrency: "SOL", QuoteCurrency: "USDT"},
+	}}
+
+	orders := []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeSell, Quantity: number(2)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeSell, Quantity: number(1)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: number(1)},
+		{Symbol: "SOLUSDT", Side: types.SideTypeSell, Quantity: number(5)},
+	}
+
+	// SOL is not limited, e.g. it's a short
+	tradable := map[string]fixedpoint.Value{"BTC": number(0.5), "ETH": number(0)}
+	checkOrders(t, planner.LimitSells(orders, tradable), []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeSell, Quantity: number(0.5)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: number(1)},
+		{Symbol: "SOLUSDT", Side: types.SideTypeSell, Quantity: number(5)},
+	})
+}
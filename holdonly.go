@@ -0,0 +1,58 @@
+package marketcap
+
+import (
+	"fmt"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+func (s *Strategy) validateHoldOnly() error {
+	for _, currency := range s.HoldOnly {
+		if !s.isTargetCurrency(currency) {
+			return fmt.Errorf("holdOnly: %s is not in targetCurrencies", currency)
+		}
+
+		if _, ok := s.ShortWeights[currency]; ok {
+			return fmt.Errorf("holdOnly: %s can not be short", currency)
+		}
+
+		// the quote currencies are traded to fund the symbols quoted in them
+		for _, c := range s.TargetCurrencies {
+			if s.QuoteCurrencies[c] == currency {
+				return fmt.Errorf("holdOnly: %s is the quote currency of %s", currency, c)
+			}
+		}
+	}
+
+	if len(s.HoldOnly) > 0 && len(s.HoldOnly) == len(s.TargetCurrencies) && s.BaseWeight.IsZero() {
+		return fmt.Errorf("holdOnly: at least one of targetCurrencies or baseWeight should be tradable")
+	}
+
+	return nil
+}
+
+func (s *Strategy) isHoldOnly(currency string) bool {
+	for _, c := range s.HoldOnly {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutHoldOnly zeroes the weights of the hold-only currencies, e.g. so the contributions never buy them
+func (s *Strategy) withoutHoldOnly(weights vector.Vector) vector.Vector {
+	if len(s.HoldOnly) == 0 {
+		return weights
+	}
+
+	tradable := weights.Copy()
+	for i, currency := range s.TargetCurrencies {
+		if s.isHoldOnly(currency) {
+			tradable[i] = fixedpoint.Zero
+		}
+	}
+	return tradable
+}
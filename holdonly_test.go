@@ -0,0 +1,25 @@
+package marketcap
+
+import (
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+func TestValidateHoldOnly(t *testing.T) {
+	for _, s := range []*Strategy{
+		{TargetCurrencies: []string{"BTC"}, HoldOnly: []string{"ETH"}},
+		{TargetCurrencies: []string{"BTC", "ETH"}, HoldOnly: []string{"ETH"}, ShortWeights: map[string]fixedpoint.Value{"ETH": number(0.1)}},
+		{TargetCurrencies: []string{"BTC", "ALT"}, HoldOnly: []string{"BTC"}, QuoteCurrencies: map[string]string{"ALT": "BTC"}},
+		{TargetCurrencies: []string{"BTC"}, HoldOnly: []string{"BTC"}},
+	} {
+		if err := s.validateHoldOnly(); err == nil {
+			t.Errorf("%+v should be rejected", s)
+		}
+	}
+
+	s := &Strategy{TargetCurrencies: []string{"BTC", "ALT"}, HoldOnly: []string{"ALT"}, QuoteCurrencies: map[string]string{"ALT": "BTC"}}
+	if err := s.validateHoldOnly(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
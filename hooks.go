@@ -0,0 +1,74 @@
+package marketcap
+
+import (
+	"context"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+// RebalancePlan is the outcome of one rebalance cycle before the orders are submitted.
+// The weights, prices and quantities are ordered as TargetCurrencies with the base currency appended.
+type RebalancePlan struct {
+	TargetWeights  vector.Vector
+	CurrentWeights vector.Vector
+	Prices         vector.Vector
+	// SymbolPrices are the prices in the quote currencies of the symbols
+	SymbolPrices vector.Vector
+	Quantities   vector.Vector
+	// Withdrawal is the base currency reserved for the planned withdrawal, it's carved out of the Quantities
+	Withdrawal fixedpoint.Value
+	// Contribution is the base currency deployed by the DCA, the buys are netted into the Orders
+	Contribution fixedpoint.Value
+
+	// Orders can be modified by the before rebalance hooks
+	Orders []types.SubmitOrder
+
+	contribution *dcaCycle
+}
+
+// BeforeRebalanceHook is called before the orders of the plan are submitted,
+// returning an error vetoes the current cycle.
+type BeforeRebalanceHook func(ctx context.Context, plan *RebalancePlan) error
+
+// AfterRebalanceHook is called when the cycle is done, err is the error of the order submission if any.
+type AfterRebalanceHook func(ctx context.Context, plan *RebalancePlan, createdOrders types.OrderSlice, err error)
+
+// PaperTradeHook is called with the simulated trades of the paper trading, they never reach the order executor
+// so the tax lots, the DCA tracker and the positions are not touched by them.
+type PaperTradeHook func(trade types.Trade)
+
+func (s *Strategy) OnBeforeRebalance(cb BeforeRebalanceHook) {
+	s.beforeRebalanceHooks = append(s.beforeRebalanceHooks, cb)
+}
+
+func (s *Strategy) OnAfterRebalance(cb AfterRebalanceHook) {
+	s.afterRebalanceHooks = append(s.afterRebalanceHooks, cb)
+}
+
+func (s *Strategy) OnPaperTrade(cb PaperTradeHook) {
+	s.paperTradeHooks = append(s.paperTradeHooks, cb)
+}
+
+func (s *Strategy) emitBeforeRebalance(ctx context.Context, plan *RebalancePlan) error {
+	for _, cb := range s.beforeRebalanceHooks {
+		if err := cb(ctx, plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Strategy) emitAfterRebalance(ctx context.Context, plan *RebalancePlan, createdOrders types.OrderSlice, err error) {
+	for _, cb := range s.afterRebalanceHooks {
+		cb(ctx, plan, createdOrders, err)
+	}
+}
+
+func (s *Strategy) emitPaperTrade(trade types.Trade) {
+	for _, cb := range s.paperTradeHooks {
+		cb(trade)
+	}
+}
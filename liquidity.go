@@ -0,0 +1,69 @@
+package marketcap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+	"github.com/narumiruna/bbgo-marketcap/weights"
+)
+
+// LiquidityCapConfig caps the target weight of each currency by its on-exchange liquidity,
+// so the basket can be exited in a reasonable time
+type LiquidityCapConfig struct {
+	// VolumeDays is the most days of the 24h volume a position can be worth, e.g. 0.1 is 10% of a day of volume
+	VolumeDays fixedpoint.Value `json:"volumeDays"`
+}
+
+func (c *LiquidityCapConfig) Validate() error {
+	if c.VolumeDays.Sign() <= 0 {
+		return fmt.Errorf("liquidityCap.volumeDays should be greater than 0")
+	}
+	return nil
+}
+
+// liquidityCaps returns the max weight of each currency: volumeDays of its 24h volume over the total value
+func (s *Strategy) liquidityCaps(ctx context.Context, session *bbgo.ExchangeSession, prices vector.Vector, totalValue fixedpoint.Value) (vector.Vector, error) {
+	caps := vector.New(len(s.TargetCurrencies))
+	for i, symbol := range s.getSymbols() {
+		tickerCtx, cancel := timeout.Context(ctx, s.Timeouts.Ticker.Duration())
+		ticker, err := session.Exchange.QueryTicker(tickerCtx, symbol)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		// the ticker volume is in the base asset of the symbol, i.e. the target currency
+		caps[i] = ticker.Volume.Mul(prices[i]).Mul(s.LiquidityCap.VolumeDays).Div(totalValue)
+	}
+	return caps, nil
+}
+
+// applyLiquidityCaps caps the target weights by the liquidity, the excess goes to the other currencies
+func (s *Strategy) applyLiquidityCaps(ctx context.Context, session *bbgo.ExchangeSession, targetWeights, prices vector.Vector, totalValue fixedpoint.Value) (vector.Vector, error) {
+	if s.LiquidityCap == nil || totalValue.Sign() <= 0 {
+		return targetWeights, nil
+	}
+
+	caps, err := s.liquidityCaps(ctx, session, prices, totalValue)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, currency := range s.TargetCurrencies {
+		// keep the max weight, otherwise the excess of the liquidity caps can push the others beyond it
+		if s.MaxWeight.Sign() > 0 {
+			caps[i] = fixedpoint.Min(caps[i], s.MaxWeight)
+		}
+
+		if targetWeights[i].Compare(caps[i]) > 0 {
+			log.Infof("cap the target weight of %s from %s to %s by its liquidity", currency, targetWeights[i].Percentage(), caps[i].Percentage())
+		}
+	}
+
+	return weights.CappedBy(targetWeights, caps), nil
+}
@@ -0,0 +1,47 @@
+package marketcap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+func TestApplyLiquidityCaps(t *testing.T) {
+	exchange := &fakeExchange{tickers: map[string]types.Ticker{
+		"BTCUSDT": {Last: number(100), Volume: number(100)},
+		"ETHUSDT": {Last: number(10), Volume: number(5000)},
+	}}
+	session := newTestSession(exchange)
+
+	s := &Strategy{
+		BaseCurrency:     "USDT",
+		TargetCurrencies: []string{"BTC", "ETH"},
+		LiquidityCap:     &LiquidityCapConfig{VolumeDays: number(0.1)},
+	}
+
+	prices := vector.Vector{number(100), number(10), number(1)}
+	totalValue := number(10000)
+
+	// 10% of a day of volume: BTC 100 * 100 * 0.1 and ETH 5000 * 10 * 0.1 of the total value
+	caps, err := s.liquidityCaps(context.Background(), session, prices, totalValue)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if caps[0].Compare(number(0.1)) != 0 || caps[1].Compare(number(0.5)) != 0 {
+		t.Fatalf("caps %v, want [0.1, 0.5]", caps)
+	}
+
+	// the excess of BTC fills ETH up to its cap and the rest goes to the base weight
+	targetWeights, err := s.applyLiquidityCaps(context.Background(), session, vector.Vector{number(0.6), number(0.3), number(0.1)}, prices, totalValue)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, want := range []float64{0.1, 0.5, 0.4} {
+		if targetWeights[i].Compare(number(want)) != 0 {
+			t.Fatalf("target weights %v, want [0.1, 0.5, 0.4]", targetWeights)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package lots
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+// Method selects the lots a sell disposes of
+type Method string
+
+const (
+	FIFO Method = "fifo"
+	LIFO Method = "lifo"
+)
+
+func (m Method) Validate() error {
+	switch m {
+	case FIFO, LIFO:
+		return nil
+	}
+	return fmt.Errorf("lot method %q is not supported, should be %s or %s", m, FIFO, LIFO)
+}
+
+// Lot is a quantity acquired by one trade, Cost is the total cost including the fee
+type Lot struct {
+	Currency   string           `json:"currency"`
+	Quantity   fixedpoint.Value `json:"quantity"`
+	Cost       fixedpoint.Value `json:"cost"`
+	AcquiredAt time.Time        `json:"acquiredAt"`
+	TradeID    uint64           `json:"tradeID"`
+}
+
+// Realization is the disposal of (a part of) a lot by a sell
+type Realization struct {
+	Currency   string           `json:"currency"`
+	Quantity   fixedpoint.Value `json:"quantity"`
+	CostBasis  fixedpoint.Value `json:"costBasis"`
+	Proceeds   fixedpoint.Value `json:"proceeds"`
+	Gain       fixedpoint.Value `json:"gain"`
+	AcquiredAt time.Time        `json:"acquiredAt"`
+	DisposedAt time.Time        `json:"disposedAt"`
+	TradeID    uint64           `json:"tradeID"`
+
+	// UnknownCostBasis is set when the sold quantity was not acquired by a tracked trade,
+	// e.g. the holdings before the tracking started, the cost basis is zero in that case.
+	UnknownCostBasis bool `json:"unknownCostBasis,omitempty"`
+}
+
+// Ledger tracks the open lots and the realized gains, it's serializable for the persistence
+type Ledger struct {
+	Method       Method           `json:"method"`
+	Lots         map[string][]Lot `json:"lots"`
+	Realizations []Realization    `json:"realizations"`
+}
+
+func NewLedger(method Method) *Ledger {
+	return &Ledger{
+		Method: method,
+		Lots:   make(map[string][]Lot),
+	}
+}
+
+// Buy opens a lot, cost is the total cost of the quantity including the fee
+func (l *Ledger) Buy(currency string, quantity, cost fixedpoint.Value, at time.Time, tradeID uint64) {
+	if quantity.Sign() <= 0 {
+		return
+	}
+
+	if l.Lots == nil {
+		l.Lots = make(map[string][]Lot)
+	}
+
+	l.Lots[currency] = append(l.Lots[currency], Lot{
+		Currency:   currency,
+		Quantity:   quantity,
+		Cost:       cost,
+		AcquiredAt: at,
+		TradeID:    tradeID,
+	})
+}
+
+// Sell disposes of quantity from the open lots by the ledger method,
+// proceeds is the total proceeds of the quantity net of the fee.
+func (l *Ledger) Sell(currency string, quantity, proceeds fixedpoint.Value, at time.Time, tradeID uint64) []Realization {
+	if quantity.Sign() <= 0 {
+		return nil
+	}
+
+	var realizations []Realization
+	remaining := quantity
+	lots := l.Lots[currency]
+
+	for remaining.Sign() > 0 && len(lots) > 0 {
+		i := 0
+		if l.Method == LIFO {
+			i = len(lots) - 1
+		}
+		lot := lots[i]
+
+		sold := fixedpoint.Min(remaining, lot.Quantity)
+		costBasis := lot.Cost.Mul(sold).Div(lot.Quantity)
+		lotProceeds := proceeds.Mul(sold).Div(quantity)
+
+		realizations = append(realizations, Realization{
+			Currency:   currency,
+			Quantity:   sold,
+			CostBasis:  costBasis,
+			Proceeds:   lotProceeds,
+			Gain:       lotProceeds.Sub(costBasis),
+			AcquiredAt: lot.AcquiredAt,
+			DisposedAt: at,
+			TradeID:    tradeID,
+		})
+
+		remaining = remaining.Sub(sold)
+		if sold.Compare(lot.Quantity) < 0 {
+			lots[i].Quantity = lot.Quantity.Sub(sold)
+			lots[i].Cost = lot.Cost.Sub(costBasis)
+		} else if l.Method == LIFO {
+			lots = lots[:i]
+		} else {
+			lots = lots[1:]
+		}
+	}
+	l.Lots[currency] = lots
+
+	if remaining.Sign() > 0 {
+		lotProceeds := proceeds.Mul(remaining).Div(quantity)
+		realizations = append(realizations, Realization{
+			Currency:         currency,
+			Quantity:         remaining,
+			CostBasis:        fixedpoint.Zero,
+			Proceeds:         lotProceeds,
+			Gain:             lotProceeds,
+			DisposedAt:       at,
+			TradeID:          tradeID,
+			UnknownCostBasis: true,
+		})
+	}
+
+	l.Realizations = append(l.Realizations, realizations...)
+	return realizations
+}
+
+// WriteCSV writes the lot-level report: the realized lots followed by the open lots
+func (l *Ledger) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{
+		"status", "currency", "quantity", "cost_basis", "proceeds", "gain", "acquired_at", "disposed_at", "trade_id", "unknown_cost_basis",
+	}); err != nil {
+		return err
+	}
+
+	for _, r := range l.Realizations {
+		if err := writer.Write([]string{
+			"realized",
+			r.Currency,
+			r.Quantity.String(),
+			r.CostBasis.String(),
+			r.Proceeds.String(),
+			r.Gain.String(),
+			formatTime(r.AcquiredAt),
+			formatTime(r.DisposedAt),
+			strconv.FormatUint(r.TradeID, 10),
+			strconv.FormatBool(r.UnknownCostBasis),
+		}); err != nil {
+			return err
+		}
+	}
+
+	currencies := make([]string, 0, len(l.Lots))
+	for currency := range l.Lots {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	for _, currency := range currencies {
+		for _, lot := range l.Lots[currency] {
+			if err := writer.Write([]string{
+				"open",
+				lot.Currency,
+				lot.Quantity.String(),
+				lot.Cost.String(),
+				"",
+				"",
+				formatTime(lot.AcquiredAt),
+				"",
+				strconv.FormatUint(lot.TradeID, 10),
+				"false",
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,155 @@
+package lots
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+var (
+	firstBuy  = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	secondBuy = time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	disposal  = time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func number(f float64) fixedpoint.Value {
+	return fixedpoint.NewFromFloat(f)
+}
+
+// testLedger holds 1 BTC bought for 100 and then 1 BTC bought for 200
+func testLedger(method Method) *Ledger {
+	ledger := NewLedger(method)
+	ledger.Buy("BTC", number(1), number(100), firstBuy, 1)
+	ledger.Buy("BTC", number(1), number(200), secondBuy, 2)
+	return ledger
+}
+
+func TestLedgerSell(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		method   Method
+		quantity float64
+		proceeds float64
+		want     []Realization
+		wantLots []Lot
+	}{
+		{
+			name:     "fifo disposes of the oldest lot first",
+			method:   FIFO,
+			quantity: 1.5,
+			proceeds: 450,
+			want: []Realization{
+				{Quantity: number(1), CostBasis: number(100), Proceeds: number(300), Gain: number(200), AcquiredAt: firstBuy},
+				{Quantity: number(0.5), CostBasis: number(100), Proceeds: number(150), Gain: number(50), AcquiredAt: secondBuy},
+			},
+			wantLots: []Lot{
+				{Quantity: number(0.5), Cost: number(100), AcquiredAt: secondBuy},
+			},
+		},
+		{
+			name:     "lifo disposes of the newest lot first",
+			method:   LIFO,
+			quantity: 1.5,
+			proceeds: 450,
+			want: []Realization{
+				{Quantity: number(1), CostBasis: number(200), Proceeds: number(300), Gain: number(100), AcquiredAt: secondBuy},
+				{Quantity: number(0.5), CostBasis: number(50), Proceeds: number(150), Gain: number(100), AcquiredAt: firstBuy},
+			},
+			wantLots: []Lot{
+				{Quantity: number(0.5), Cost: number(50), AcquiredAt: firstBuy},
+			},
+		},
+		{
+			name:     "partial lot keeps the rest of its cost",
+			method:   FIFO,
+			quantity: 0.25,
+			proceeds: 50,
+			want: []Realization{
+				{Quantity: number(0.25), CostBasis: number(25), Proceeds: number(50), Gain: number(25), AcquiredAt: firstBuy},
+			},
+			wantLots: []Lot{
+				{Quantity: number(0.75), Cost: number(75), AcquiredAt: firstBuy},
+				{Quantity: number(1), Cost: number(200), AcquiredAt: secondBuy},
+			},
+		},
+		{
+			name:     "untracked quantity has an unknown cost basis",
+			method:   FIFO,
+			quantity: 3,
+			proceeds: 600,
+			want: []Realization{
+				{Quantity: number(1), CostBasis: number(100), Proceeds: number(200), Gain: number(100), AcquiredAt: firstBuy},
+				{Quantity: number(1), CostBasis: number(200), Proceeds: number(200), Gain: number(0), AcquiredAt: secondBuy},
+				{Quantity: number(1), CostBasis: number(0), Proceeds: number(200), Gain: number(200), UnknownCostBasis: true},
+			},
+		},
+	} {
+		ledger := testLedger(c.method)
+		realizations := ledger.Sell("BTC", number(c.quantity), number(c.proceeds), disposal, 3)
+
+		if len(realizations) != len(c.want) {
+			t.Fatalf("%s: got %d realizations %+v, want %d", c.name, len(realizations), realizations, len(c.want))
+		}
+		for i, want := range c.want {
+			got := realizations[i]
+			if got.Quantity.Compare(want.Quantity) != 0 ||
+				got.CostBasis.Compare(want.CostBasis) != 0 ||
+				got.Proceeds.Compare(want.Proceeds) != 0 ||
+				got.Gain.Compare(want.Gain) != 0 ||
+				!got.AcquiredAt.Equal(want.AcquiredAt) ||
+				!got.DisposedAt.Equal(disposal) ||
+				got.UnknownCostBasis != want.UnknownCostBasis {
+				t.Errorf("%s: realization %d = %+v, want %+v", c.name, i, got, want)
+			}
+		}
+
+		lots := ledger.Lots["BTC"]
+		if len(lots) != len(c.wantLots) {
+			t.Fatalf("%s: got %d open lots %+v, want %d", c.name, len(lots), lots, len(c.wantLots))
+		}
+		for i, want := range c.wantLots {
+			got := lots[i]
+			if got.Quantity.Compare(want.Quantity) != 0 || got.Cost.Compare(want.Cost) != 0 || !got.AcquiredAt.Equal(want.AcquiredAt) {
+				t.Errorf("%s: open lot %d = %+v, want %+v", c.name, i, got, want)
+			}
+		}
+
+		if len(ledger.Realizations) != len(c.want) {
+			t.Errorf("%s: the ledger recorded %d realizations, want %d", c.name, len(ledger.Realizations), len(c.want))
+		}
+	}
+}
+
+func TestLedgerWriteCSV(t *testing.T) {
+	ledger := NewLedger(FIFO)
+	ledger.Buy("BTC", number(1), number(100), firstBuy, 1)
+	ledger.Sell("BTC", number(0.5), number(80), disposal, 2)
+	ledger.Sell("ETH", number(2), number(10), disposal, 3)
+
+	var buf bytes.Buffer
+	if err := ledger.WriteCSV(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "status,currency,quantity,cost_basis,proceeds,gain,acquired_at,disposed_at,trade_id,unknown_cost_basis\n" +
+		"realized,BTC,0.5,50,80,30,2022-01-01T00:00:00Z,2022-03-01T00:00:00Z,2,false\n" +
+		"realized,ETH,2,0,10,10,,2022-03-01T00:00:00Z,3,true\n" +
+		"open,BTC,0.5,50,,,2022-01-01T00:00:00Z,,1,false\n"
+	if got := buf.String(); got != want {
+		t.Errorf("csv:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMethodValidate(t *testing.T) {
+	for _, method := range []Method{FIFO, LIFO} {
+		if err := method.Validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", method, err)
+		}
+	}
+
+	if err := Method("hifo").Validate(); err == nil {
+		t.Errorf("hifo should not be supported")
+	}
+}
@@ -0,0 +1,74 @@
+package marketcap
+
+import (
+	"fmt"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+func (s *Strategy) validateShortWeights() error {
+	shortSum := fixedpoint.Zero
+	for currency, weight := range s.ShortWeights {
+		if !s.isTargetCurrency(currency) {
+			return fmt.Errorf("shortWeights: %s is not in targetCurrencies", currency)
+		}
+
+		if weight.Sign() >= 0 {
+			return fmt.Errorf("shortWeights: the weight of %s should be negative", currency)
+		}
+
+		shortSum = shortSum.Add(weight)
+	}
+
+	if len(s.ShortWeights) > 0 && len(s.ShortWeights) == len(s.TargetCurrencies) {
+		return fmt.Errorf("shortWeights: at least one of targetCurrencies should be long")
+	}
+
+	// the shorts plus the base weight should not exceed the whole portfolio
+	if shortSum.Abs().Add(s.BaseWeight).Compare(fixedpoint.One) > 0 {
+		return fmt.Errorf("shortWeights: the sum of the short weights and baseWeight should not greater than 100%%")
+	}
+
+	return nil
+}
+
+func (s *Strategy) checkMarginSession(session *bbgo.ExchangeSession) error {
+	if len(s.ShortWeights) > 0 && !session.Margin && !session.IsolatedMargin {
+		return fmt.Errorf("shortWeights needs a margin session, but session %s is not margin", session.Name)
+	}
+	return nil
+}
+
+// netQuantity is the quantity held net of the borrowed amount, it's negative for a short position
+func netQuantity(balance types.Balance) fixedpoint.Value {
+	return balance.Total().Sub(balance.Borrowed).Sub(balance.Interest)
+}
+
+// applyMarginSideEffects borrows on the sells and repays on the buys of the short currencies
+func (s *Strategy) applyMarginSideEffects(orders []types.SubmitOrder) []types.SubmitOrder {
+	if len(s.ShortWeights) == 0 {
+		return orders
+	}
+
+	shortSymbols := make(map[string]struct{})
+	for currency := range s.ShortWeights {
+		symbol, _ := s.route(currency)
+		shortSymbols[symbol] = struct{}{}
+	}
+
+	for i, order := range orders {
+		if _, ok := shortSymbols[order.Symbol]; !ok {
+			continue
+		}
+
+		switch order.Side {
+		case types.SideTypeSell:
+			orders[i].MarginSideEffect = types.SideEffectTypeMarginBuy
+		case types.SideTypeBuy:
+			orders[i].MarginSideEffect = types.SideEffectTypeAutoRepay
+		}
+	}
+	return orders
+}
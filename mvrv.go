@@ -0,0 +1,57 @@
+package marketcap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/datasource/glassnode/glassnodeapi"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+// MVRVTiltConfig underweights the currencies with extreme MVRV and overweights the depressed ones
+type MVRVTiltConfig struct {
+	// Strength is the exponent of the tilt, each weight is multiplied by MVRV^-strength before the renormalization
+	Strength fixedpoint.Value `json:"strength"`
+}
+
+func (c *MVRVTiltConfig) Validate() error {
+	if c.Strength.Sign() < 0 {
+		return fmt.Errorf("mvrvTilt.strength should not less than 0")
+	}
+	return nil
+}
+
+// glassnodeMVRV queries the MVRV ratio from glassnode
+// https://docs.glassnode.com/api/market#mvrv-ratio
+type glassnodeMVRV struct {
+	client *glassnodeapi.RestClient
+}
+
+func newGlassnodeMVRV(apiKey string) *glassnodeMVRV {
+	client := glassnodeapi.NewRestClient()
+	client.Auth(apiKey)
+	return &glassnodeMVRV{client: client}
+}
+
+func (g *glassnodeMVRV) QueryMVRV(ctx context.Context, currency string) (float64, error) {
+	req := glassnodeapi.MarketRequest{
+		Client: g.client,
+		Asset:  currency,
+		// 25 hours ago
+		Since:    time.Now().Add(-25 * time.Hour).Unix(),
+		Interval: glassnodeapi.Interval24h,
+		Metric:   "mvrv",
+	}
+
+	resp, err := req.Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.IsEmpty() {
+		return 0, fmt.Errorf("no mvrv data of %s", currency)
+	}
+
+	return resp.LastValue(), nil
+}
@@ -0,0 +1,86 @@
+package marketcap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// NotificationRoutes routes the notifications of each event type to a notification channel,
+// the default channel is used if the route is empty
+type NotificationRoutes struct {
+	// Trade is the channel of the trade fills
+	Trade string `json:"trade"`
+	// Error is the channel of the rebalance errors
+	Error string `json:"error"`
+	// Summary is the channel of the daily summaries
+	Summary string `json:"summary"`
+}
+
+func (s *Strategy) notify(channel string, obj interface{}, args ...interface{}) {
+	if s.Notifiability == nil {
+		return
+	}
+
+	if len(channel) > 0 {
+		s.Notifiability.NotifyTo(channel, obj, args...)
+		return
+	}
+
+	s.Notifiability.Notify(obj, args...)
+}
+
+func (s *Strategy) notifyTrade(trade types.Trade) {
+	s.notify(s.NotificationRoutes.Trade, trade)
+}
+
+func (s *Strategy) notifyError(obj interface{}, args ...interface{}) {
+	s.notify(s.NotificationRoutes.Error, obj, args...)
+}
+
+// runDailySummary notifies the summary of the last rebalance every 24 hours until ctx is done
+func (s *Strategy) runDailySummary(ctx context.Context) {
+	ticker := s.Clock.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C():
+			if summary := s.summary(); len(summary) > 0 {
+				s.notify(s.NotificationRoutes.Summary, summary)
+			}
+		}
+	}
+}
+
+func (s *Strategy) summary() string {
+	s.statusMutex.Lock()
+	plan := s.lastPlan
+	lastRebalanceTime := s.lastRebalanceTime
+	s.statusMutex.Unlock()
+
+	if plan == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s daily summary, last rebalance at %s\n", s.InstanceID(), lastRebalanceTime.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "total value: %s %s\n", plan.Prices.Mul(plan.Quantities).Sum().String(), s.BaseCurrency)
+
+	currencies := append(append([]string{}, s.TargetCurrencies...), s.BaseCurrency)
+	for i, currency := range currencies {
+		fmt.Fprintf(&sb, "%s: weight %s, target %s\n",
+			currency,
+			plan.CurrentWeights[i].Percentage(),
+			plan.TargetWeights[i].Percentage())
+	}
+	fmt.Fprintf(&sb, "orders: %d", len(plan.Orders))
+
+	return sb.String()
+}
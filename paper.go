@@ -0,0 +1,282 @@
+package marketcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/service"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+)
+
+// PaperConfig trades against a simulated balance sheet instead of the account,
+// the orders are filled at the live tickers so a basket can be trialed with zero capital.
+type PaperConfig struct {
+	// InitialBalances are the simulated balances the paper trading starts with
+	InitialBalances map[string]fixedpoint.Value `json:"initialBalances"`
+	// FeeRate is charged in the quote currency on each simulated fill
+	FeeRate fixedpoint.Value `json:"feeRate"`
+}
+
+func (c *PaperConfig) Validate() error {
+	if len(c.InitialBalances) == 0 {
+		return fmt.Errorf("paper.initialBalances should not be empty")
+	}
+
+	for currency, amount := range c.InitialBalances {
+		if amount.Sign() < 0 {
+			return fmt.Errorf("paper.initialBalances.%s should not less than 0", currency)
+		}
+	}
+
+	if c.FeeRate.Sign() < 0 {
+		return fmt.Errorf("paper.feeRate should not less than 0")
+	}
+
+	return nil
+}
+
+// PaperPerformance is the hypothetical performance of the paper trading in the base currency
+type PaperPerformance struct {
+	InitialValue fixedpoint.Value `json:"initialValue"`
+	Value        fixedpoint.Value `json:"value"`
+	Return       fixedpoint.Value `json:"return"`
+	Fees         fixedpoint.Value `json:"fees"`
+	Trades       int              `json:"trades"`
+}
+
+// paperAccount is the simulated balance sheet, it's persisted so the paper trading survives restarts
+type paperAccount struct {
+	mu sync.Mutex
+
+	Balances map[string]fixedpoint.Value `json:"balances"`
+	// InitialValue is the value of the initial balances at the first rebalance, zero before it
+	InitialValue fixedpoint.Value `json:"initialValue"`
+	// Fees are the simulated fees in the base currency
+	Fees    fixedpoint.Value `json:"fees"`
+	Trades  int              `json:"trades"`
+	TradeID uint64           `json:"tradeID"`
+
+	// value is the value of the balances at the last rebalance
+	value fixedpoint.Value
+}
+
+func (s *Strategy) loadPaperAccount() {
+	account := &paperAccount{Balances: make(map[string]fixedpoint.Value)}
+
+	if s.Persistence != nil {
+		err := s.loadAccountState(account, "paper")
+		if err == nil && len(account.Balances) > 0 {
+			s.paperAccount = account
+			return
+		}
+		if err != nil && !errors.Is(err, service.ErrPersistenceNotExists) {
+			log.WithError(err).Warnf("can not load the paper account, start with the initial balances")
+		}
+	}
+
+	account.Balances = make(map[string]fixedpoint.Value)
+	for currency, amount := range s.Paper.InitialBalances {
+		account.Balances[currency] = amount
+	}
+	s.paperAccount = account
+}
+
+func (s *Strategy) savePaperAccount() {
+	if s.Persistence == nil {
+		return
+	}
+
+	if err := s.Persistence.Save(s.paperAccount, s.accountID(), "paper"); err != nil {
+		log.WithError(err).Errorf("can not save the paper account")
+	}
+}
+
+func (a *paperAccount) balanceMap() types.BalanceMap {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	balances := make(types.BalanceMap)
+	for currency, amount := range a.Balances {
+		balances[currency] = types.Balance{Currency: currency, Available: amount}
+	}
+	return balances
+}
+
+// updateValue records the value of the balances priced by the plan, the first value is the initial value
+func (a *paperAccount) updateValue(value fixedpoint.Value) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.InitialValue.IsZero() {
+		a.InitialValue = value
+	}
+	a.value = value
+}
+
+func (a *paperAccount) performance() PaperPerformance {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	performance := PaperPerformance{
+		InitialValue: a.InitialValue,
+		Value:        a.value,
+		Fees:         a.Fees,
+		Trades:       a.Trades,
+	}
+	if a.InitialValue.Sign() > 0 {
+		performance.Return = a.value.Div(a.InitialValue).Sub(fixedpoint.One)
+	}
+	return performance
+}
+
+// fillPaperOrders fills the orders against the live tickers, buys at the ask and sells at the bid.
+// The orders the simulated balances can not cover are reduced to the available amount.
+func (s *Strategy) fillPaperOrders(ctx context.Context, session *bbgo.ExchangeSession, plan *RebalancePlan) (types.OrderSlice, error) {
+	var filledOrders types.OrderSlice
+	var trades []types.Trade
+
+	account := s.paperAccount
+
+	// the sells go first so their proceeds can fund the buys
+	orders := append([]types.SubmitOrder{}, plan.Orders...)
+	sortSellsFirst(orders)
+
+	for _, order := range orders {
+		market, ok := session.Market(order.Symbol)
+		if !ok {
+			return filledOrders, fmt.Errorf("market %s not found", order.Symbol)
+		}
+
+		tickerCtx, cancel := timeout.Context(ctx, s.Timeouts.Ticker.Duration())
+		ticker, err := session.Exchange.QueryTicker(tickerCtx, order.Symbol)
+		cancel()
+		if err != nil {
+			return filledOrders, err
+		}
+
+		price := ticker.Sell
+		if order.Side == types.SideTypeSell {
+			price = ticker.Buy
+		}
+		if price.Sign() <= 0 {
+			price = ticker.Last
+		}
+
+		account.mu.Lock()
+		quantity := order.Quantity
+		if order.Side == types.SideTypeBuy {
+			cost := quantity.Mul(price).Mul(fixedpoint.One.Add(s.Paper.FeeRate))
+			if available := account.Balances[market.QuoteCurrency]; cost.Compare(available) > 0 {
+				quantity = available.Div(price.Mul(fixedpoint.One.Add(s.Paper.FeeRate)))
+			}
+		} else {
+			quantity = fixedpoint.Min(quantity, account.Balances[market.BaseCurrency])
+		}
+
+		if quantity.Sign() <= 0 {
+			account.mu.Unlock()
+			log.Infof("paper: not enough balance for %s, skip it", order.String())
+			continue
+		}
+
+		quoteQuantity := quantity.Mul(price)
+		fee := quoteQuantity.Mul(s.Paper.FeeRate)
+		if order.Side == types.SideTypeBuy {
+			account.Balances[market.BaseCurrency] = account.Balances[market.BaseCurrency].Add(quantity)
+			account.Balances[market.QuoteCurrency] = account.Balances[market.QuoteCurrency].Sub(quoteQuantity.Add(fee))
+		} else {
+			account.Balances[market.BaseCurrency] = account.Balances[market.BaseCurrency].Sub(quantity)
+			account.Balances[market.QuoteCurrency] = account.Balances[market.QuoteCurrency].Add(quoteQuantity.Sub(fee))
+		}
+
+		account.Trades++
+		account.TradeID++
+		tradeID := account.TradeID
+		account.mu.Unlock()
+
+		// the fee is counted in the base currency, the quote currency out of the basket is priced by its tickers
+		if feeValue, err := s.baseValue(market.QuoteCurrency, fee); err != nil {
+			log.WithError(err).Warnf("paper: can not value the fee %s %s, it's not counted in the fees", fee.String(), market.QuoteCurrency)
+		} else {
+			account.mu.Lock()
+			account.Fees = account.Fees.Add(feeValue)
+			account.mu.Unlock()
+		}
+
+		now := s.Clock.Now()
+		order.Quantity = quantity
+		order.Price = price
+		filledOrders = append(filledOrders, types.Order{
+			SubmitOrder:      order,
+			Exchange:         session.Exchange.Name(),
+			OrderID:          tradeID,
+			Status:           types.OrderStatusFilled,
+			ExecutedQuantity: quantity,
+			CreationTime:     types.Time(now),
+			UpdateTime:       types.Time(now),
+		})
+
+		trades = append(trades, types.Trade{
+			ID:            tradeID,
+			OrderID:       tradeID,
+			Exchange:      session.Exchange.Name(),
+			Price:         price,
+			Quantity:      quantity,
+			QuoteQuantity: quoteQuantity,
+			Symbol:        order.Symbol,
+			Side:          order.Side,
+			IsBuyer:       order.Side == types.SideTypeBuy,
+			Fee:           fee,
+			FeeCurrency:   market.QuoteCurrency,
+			Time:          types.Time(now),
+		})
+
+		log.Infof("paper: filled %s %s %v at %v", order.Symbol, order.Side, quantity, price)
+	}
+
+	s.savePaperAccount()
+
+	for _, trade := range trades {
+		s.emitPaperTrade(trade)
+	}
+
+	return filledOrders, nil
+}
+
+// paperValue values the simulated balances in the base currency by the plan prices
+func (s *Strategy) paperValue(plan *RebalancePlan) fixedpoint.Value {
+	balances := s.paperAccount.balanceMap()
+
+	value := fixedpoint.Zero
+	for i, currency := range s.TargetCurrencies {
+		value = value.Add(balances[currency].Available.Mul(plan.Prices[i]))
+	}
+	return value.Add(balances[s.BaseCurrency].Available)
+}
+
+// reportPaperPerformance updates the value of the simulated balances and notifies the performance
+func (s *Strategy) reportPaperPerformance(plan *RebalancePlan) {
+	s.paperAccount.updateValue(s.paperValue(plan))
+	s.savePaperAccount()
+
+	performance := s.paperAccount.performance()
+	s.notify(s.NotificationRoutes.Summary, fmt.Sprintf("%s paper trading: value %s %s, return %s, fees %s %s, trades %d",
+		s.InstanceID(),
+		performance.Value.String(), s.BaseCurrency,
+		performance.Return.Percentage(),
+		performance.Fees.String(), s.BaseCurrency,
+		performance.Trades))
+}
+
+func sortSellsFirst(orders []types.SubmitOrder) {
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].Side == types.SideTypeSell && orders[j].Side != types.SideTypeSell
+	})
+}
@@ -0,0 +1,156 @@
+package marketcap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/clock"
+	"github.com/narumiruna/bbgo-marketcap/execution"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+// fakeExchange serves the tickers, the other calls of the exchange are not implemented
+type fakeExchange struct {
+	types.Exchange
+
+	tickers map[string]types.Ticker
+}
+
+func (e *fakeExchange) Name() types.ExchangeName {
+	return types.ExchangeBinance
+}
+
+func (e *fakeExchange) NewStream() types.Stream {
+	return &types.StandardStream{}
+}
+
+func (e *fakeExchange) QueryTicker(ctx context.Context, symbol string) (*types.Ticker, error) {
+	ticker, ok := e.tickers[symbol]
+	if !ok {
+		return nil, fmt.Errorf("no ticker of %s", symbol)
+	}
+	return &ticker, nil
+}
+
+func newTestSession(exchange types.Exchange, markets ...types.Market) *bbgo.ExchangeSession {
+	session := bbgo.NewExchangeSession("test", exchange)
+	for _, market := range markets {
+		session.Markets()[market.Symbol] = market
+	}
+	return session
+}
+
+func number(f float64) fixedpoint.Value {
+	return fixedpoint.NewFromFloat(f)
+}
+
+func newPaperStrategy(balances map[string]fixedpoint.Value) (*Strategy, *bbgo.ExchangeSession) {
+	exchange := &fakeExchange{tickers: map[string]types.Ticker{
+		"BTCUSDT": {Buy: number(99), Sell: number(100), Last: number(99.5)},
+		"ETHUSDT": {Buy: number(10), Sell: number(11), Last: number(10.5)},
+	}}
+	session := newTestSession(exchange,
+		types.Market{Symbol: "BTCUSDT", BaseCurrency: "BTC", QuoteCurrency: "USDT"},
+		types.Market{Symbol: "ETHUSDT", BaseCurrency: "ETH", QuoteCurrency: "USDT"})
+
+	s := &Strategy{
+		BaseCurrency:     "USDT",
+		TargetCurrencies: []string{"BTC", "ETH"},
+		Paper:            &PaperConfig{InitialBalances: balances, FeeRate: number(0.01)},
+		Clock:            clock.NewManual(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	s.loadPaperAccount()
+	s.orderExecutor = execution.NewOrderExecutor(session, nil, s.getSymbols())
+	return s, session
+}
+
+func TestFillPaperOrders(t *testing.T) {
+	s, session := newPaperStrategy(map[string]fixedpoint.Value{"USDT": number(150), "ETH": number(10)})
+
+	var trades []types.Trade
+	s.OnPaperTrade(func(trade types.Trade) {
+		trades = append(trades, trade)
+	})
+
+	// the simulated fills never reach the order executor
+	s.orderExecutor.OnTrade(func(trade types.Trade) {
+		t.Errorf("the paper trade %d reached the order executor", trade.ID)
+	})
+
+	plan := &RebalancePlan{
+		Prices: vector.Vector{number(99.5), number(10.5), number(1)},
+		Orders: []types.SubmitOrder{
+			{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(2), Price: number(99.5)},
+			// only 10 ETH is held
+			{Symbol: "ETHUSDT", Side: types.SideTypeSell, Quantity: number(20), Price: number(10.5)},
+		},
+	}
+
+	orders, err := s.fillPaperOrders(context.Background(), session, plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the sell fills first at the bid and funds the buy at the ask
+	if len(orders) != 2 || len(trades) != 2 {
+		t.Fatalf("got %d orders and %d trades, want 2", len(orders), len(trades))
+	}
+	for i, want := range []struct {
+		symbol   string
+		quantity float64
+		price    float64
+	}{{"ETHUSDT", 10, 10}, {"BTCUSDT", 2, 100}} {
+		if orders[i].Symbol != want.symbol || orders[i].Quantity.Compare(number(want.quantity)) != 0 || orders[i].Price.Compare(number(want.price)) != 0 {
+			t.Errorf("order %d = %s %v @ %v, want %s %v @ %v", i, orders[i].Symbol, orders[i].Quantity, orders[i].Price, want.symbol, want.quantity, want.price)
+		}
+		if orders[i].Status != types.OrderStatusFilled || trades[i].OrderID != orders[i].OrderID {
+			t.Errorf("order %d should be filled by trade %d", orders[i].OrderID, trades[i].OrderID)
+		}
+	}
+
+	// 150 + 10 * 10 * 0.99 - 2 * 100 * 1.01
+	balances := s.paperAccount.balanceMap()
+	for currency, want := range map[string]float64{"USDT": 47, "BTC": 2, "ETH": 0} {
+		if got := balances[currency].Available; got.Compare(number(want)) != 0 {
+			t.Errorf("%s balance = %v, want %v", currency, got, want)
+		}
+	}
+
+	performance := s.paperAccount.performance()
+	if performance.Fees.Compare(number(3)) != 0 || performance.Trades != 2 {
+		t.Errorf("fees %v and trades %d, want 3 and 2", performance.Fees, performance.Trades)
+	}
+}
+
+func TestFillPaperOrdersReducedBuy(t *testing.T) {
+	s, session := newPaperStrategy(map[string]fixedpoint.Value{"USDT": number(101)})
+
+	plan := &RebalancePlan{
+		Prices: vector.Vector{number(99.5), number(10.5), number(1)},
+		Orders: []types.SubmitOrder{
+			{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(2), Price: number(99.5)},
+			// nothing to sell
+			{Symbol: "ETHUSDT", Side: types.SideTypeSell, Quantity: number(1), Price: number(10.5)},
+		},
+	}
+
+	orders, err := s.fillPaperOrders(context.Background(), session, plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the balance covers 1 BTC at 100 with the fee
+	if len(orders) != 1 || orders[0].Symbol != "BTCUSDT" || orders[0].Quantity.Compare(number(1)) != 0 {
+		t.Fatalf("got orders %v, want to buy 1 BTC", orders)
+	}
+
+	if usdt := s.paperAccount.balanceMap()["USDT"].Available; !usdt.IsZero() {
+		t.Errorf("USDT balance = %v, want 0", usdt)
+	}
+}
@@ -0,0 +1,73 @@
+package marketcap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+// Preset is a named basket that expands into the target currencies and the weighting settings,
+// the fields set in the config take precedence over the preset.
+type Preset struct {
+	TargetCurrencies []string
+	MaxWeight        fixedpoint.Value
+	BaseWeight       fixedpoint.Value
+}
+
+var presets = map[string]Preset{
+	// the largest assets by market cap without the stablecoins
+	"top10-ex-stables": {
+		TargetCurrencies: []string{"BTC", "ETH", "BNB", "XRP", "SOL", "ADA", "DOGE", "TRX", "LINK", "LTC"},
+		MaxWeight:        fixedpoint.NewFromFloat(0.4),
+		BaseWeight:       fixedpoint.NewFromFloat(0.02),
+	},
+	// bitcoin and ether only
+	"btc-eth": {
+		TargetCurrencies: []string{"BTC", "ETH"},
+		BaseWeight:       fixedpoint.NewFromFloat(0.02),
+	},
+	// the blue chip DeFi tokens, capped so no protocol dominates the basket
+	"defi-basket": {
+		TargetCurrencies: []string{"UNI", "LINK", "AAVE", "MKR", "LDO", "CRV", "COMP", "SNX"},
+		MaxWeight:        fixedpoint.NewFromFloat(0.25),
+		BaseWeight:       fixedpoint.NewFromFloat(0.05),
+	},
+}
+
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset fills the unset target currencies and weighting settings from the preset,
+// an explicit zero maxWeight or baseWeight in the config overrides the preset
+func (s *Strategy) applyPreset() error {
+	if len(s.Preset) == 0 {
+		return nil
+	}
+
+	preset, ok := presets[s.Preset]
+	if !ok {
+		return fmt.Errorf("unknown preset %q, available presets: %s", s.Preset, strings.Join(presetNames(), ", "))
+	}
+
+	if len(s.TargetCurrencies) == 0 {
+		s.TargetCurrencies = append([]string{}, preset.TargetCurrencies...)
+	}
+
+	if s.MaxWeight.IsZero() && !s.configKeys["maxWeight"] {
+		s.MaxWeight = preset.MaxWeight
+	}
+
+	if s.BaseWeight.IsZero() && !s.configKeys["baseWeight"] {
+		s.BaseWeight = preset.BaseWeight
+	}
+
+	return nil
+}
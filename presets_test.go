@@ -0,0 +1,24 @@
+package marketcap
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPresetExplicitZero(t *testing.T) {
+	var s Strategy
+	if err := json.Unmarshal([]byte(`{"preset": "top10-ex-stables", "maxWeight": 0}`), &s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.applyPreset(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !s.MaxWeight.IsZero() {
+		t.Errorf("maxWeight = %s, want the explicit 0", s.MaxWeight.String())
+	}
+	if s.BaseWeight.Compare(presets["top10-ex-stables"].BaseWeight) != 0 {
+		t.Errorf("baseWeight = %s, want the preset %s", s.BaseWeight.String(), presets["top10-ex-stables"].BaseWeight.String())
+	}
+}
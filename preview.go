@@ -0,0 +1,98 @@
+package marketcap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+// Preview fetches the target weights and the balances of the session and writes the would-be
+// order plan to w without submitting any order.
+func (s *Strategy) Preview(ctx context.Context, session *bbgo.ExchangeSession, w io.Writer) error {
+	if err := s.Initialize(); err != nil {
+		return err
+	}
+
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	s.setup(session)
+
+	subSessions, err := s.aggregateSessions(session)
+	if err != nil {
+		return err
+	}
+	s.subSessions = subSessions
+
+	targetWeights, err := s.getTargetWeights(ctx)
+	if err != nil {
+		return err
+	}
+
+	plan, err := s.buildPlan(ctx, session, targetWeights)
+	if err != nil {
+		return err
+	}
+
+	costs, totalCost := s.estimateCosts(ctx, session, plan)
+	return s.writePlan(w, plan, costs, totalCost)
+}
+
+func (s *Strategy) writePlan(w io.Writer, plan *RebalancePlan, costs []OrderCost, totalCost fixedpoint.Value) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "instance:\t%s\n", s.InstanceID())
+	fmt.Fprintf(tw, "total value:\t%s %s\n\n", plan.Prices.Mul(plan.Quantities).Sum().String(), s.BaseCurrency)
+
+	fmt.Fprintln(tw, "ASSET\tPRICE\tQUANTITY\tWEIGHT\tTARGET")
+	currencies := append(append([]string{}, s.TargetCurrencies...), s.BaseCurrency)
+	for i, currency := range currencies {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			currency,
+			plan.Prices[i].String(),
+			plan.Quantities[i].String(),
+			plan.CurrentWeights[i].Percentage(),
+			plan.TargetWeights[i].Percentage())
+	}
+
+	fmt.Fprintln(tw)
+	if len(plan.Orders) == 0 {
+		fmt.Fprintln(tw, "no order to submit")
+		return tw.Flush()
+	}
+
+	fmt.Fprintf(tw, "SYMBOL\tSIDE\tTYPE\tQUANTITY\tPRICE\tAMOUNT\tFEE (%s)\tSLIPPAGE (%s)\n", s.BaseCurrency, s.BaseCurrency)
+	traded := fixedpoint.Zero
+	for i, order := range plan.Orders {
+		slippage := "-"
+		if costs[i].SlippageKnown {
+			slippage = costs[i].Slippage.String()
+		}
+		if costs[i].DepthExhausted {
+			slippage += " (depth exhausted)"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			order.Symbol,
+			order.Side,
+			order.Type,
+			order.Quantity.String(),
+			order.Price.String(),
+			order.Quantity.Mul(order.Price).String(),
+			costs[i].Fee.String(),
+			slippage)
+		traded = traded.Add(costs[i].Amount)
+	}
+
+	if traded.Sign() > 0 {
+		fmt.Fprintf(tw, "\nestimated cost:\t%s %s, %s of the traded %s %s\n",
+			totalCost.String(), s.BaseCurrency, totalCost.Div(traded).Percentage(), traded.String(), s.BaseCurrency)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,97 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+// TickerQuerier queries the ticker of a symbol, it's implemented by types.Exchange
+type TickerQuerier interface {
+	QueryTicker(ctx context.Context, symbol string) (*types.Ticker, error)
+}
+
+// Pricer prices the assets of the portfolio in the base currency
+type Pricer struct {
+	querier TickerQuerier
+	timeout time.Duration
+}
+
+// NewPricer creates a pricer, each ticker query is limited by timeout if it's positive
+func NewPricer(querier TickerQuerier, timeout time.Duration) *Pricer {
+	return &Pricer{
+		querier: querier,
+		timeout: timeout,
+	}
+}
+
+// maxChainLength limits the number of tickers chained to price a currency
+const maxChainLength = 4
+
+// Route returns the symbol a currency is priced by and the quote currency of the symbol
+type Route func(currency string) (symbol, quote string)
+
+// Prices returns the last prices of the currencies in the base currency and the last prices of their symbols
+// in the quote currencies of the symbols, the price of the base currency itself (1) is appended to both as the
+// last element. A currency quoted in another currency is priced by chaining the tickers, e.g. ALT = ALTBTC * BTCUSDT.
+func (p *Pricer) Prices(ctx context.Context, currencies []string, baseCurrency string, route Route) (prices, symbolPrices vector.Vector, err error) {
+	pricesInBase := map[string]fixedpoint.Value{baseCurrency: fixedpoint.One}
+	lastPrices := make(map[string]fixedpoint.Value)
+
+	for _, currency := range currencies {
+		price, err := p.priceInBase(ctx, currency, route, pricesInBase, lastPrices, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		prices = append(prices, price)
+		symbolPrices = append(symbolPrices, lastPrices[currency])
+	}
+
+	// append base currency price
+	prices = append(prices, fixedpoint.One)
+	symbolPrices = append(symbolPrices, fixedpoint.One)
+
+	return prices, symbolPrices, nil
+}
+
+func (p *Pricer) priceInBase(ctx context.Context, currency string, route Route, pricesInBase, lastPrices map[string]fixedpoint.Value, depth int) (fixedpoint.Value, error) {
+	if price, ok := pricesInBase[currency]; ok {
+		return price, nil
+	}
+
+	if depth >= maxChainLength {
+		return fixedpoint.Zero, fmt.Errorf("can not price %s, the ticker chain is longer than %d", currency, maxChainLength)
+	}
+
+	symbol, quote := route(currency)
+	if quote == currency {
+		return fixedpoint.Zero, fmt.Errorf("can not price %s by itself", currency)
+	}
+
+	ticker, err := p.queryTicker(ctx, symbol)
+	if err != nil {
+		return fixedpoint.Zero, err
+	}
+
+	quotePrice, err := p.priceInBase(ctx, quote, route, pricesInBase, lastPrices, depth+1)
+	if err != nil {
+		return fixedpoint.Zero, err
+	}
+
+	price := ticker.Last.Mul(quotePrice)
+	pricesInBase[currency] = price
+	lastPrices[currency] = ticker.Last
+	return price, nil
+}
+
+func (p *Pricer) queryTicker(ctx context.Context, symbol string) (*types.Ticker, error) {
+	ctx, cancel := timeout.Context(ctx, p.timeout)
+	defer cancel()
+	return p.querier.QueryTicker(ctx, symbol)
+}
@@ -0,0 +1,165 @@
+package marketcap
+
+import (
+	"context"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+)
+
+// rebalanceProgress is the order plan of the current cycle and its progress, it's persisted so the open orders
+// of the cycle can be re-attached after a crash instead of being left behind.
+type rebalanceProgress struct {
+	StartTime time.Time `json:"startTime"`
+	// OrderIDs are the ids of the submitted orders
+	OrderIDs []uint64 `json:"orderIDs"`
+	// Pending are the orders of the plan not submitted yet
+	Pending []types.SubmitOrder `json:"pending"`
+}
+
+func (s *Strategy) saveProgress(progress *rebalanceProgress) {
+	if s.Persistence == nil {
+		return
+	}
+
+	if err := s.Persistence.Save(progress, s.InstanceID(), "progress"); err != nil {
+		log.WithError(err).Errorf("can not save the rebalance progress")
+	}
+}
+
+func (s *Strategy) loadProgress() *rebalanceProgress {
+	if s.Persistence == nil {
+		return nil
+	}
+
+	var progress rebalanceProgress
+	if err := s.Persistence.Load(&progress, s.InstanceID(), "progress"); err != nil {
+		return nil
+	}
+	return &progress
+}
+
+// clearProgress forgets the last cycle once its orders are cancelled by the next cycle
+func (s *Strategy) clearProgress() {
+	s.saveProgress(&rebalanceProgress{})
+}
+
+// resumeRebalance re-attaches the open orders of the persisted cycle to the order executor and keeps its pending
+// orders, so the next trigger finishes the cycle instead of cancelling its orders and planning from scratch.
+func (s *Strategy) resumeRebalance(ctx context.Context, session *bbgo.ExchangeSession) error {
+	progress := s.loadProgress()
+	if progress == nil || (len(progress.OrderIDs) == 0 && len(progress.Pending) == 0) {
+		return nil
+	}
+
+	s.rebalanceMutex.Lock()
+	defer s.rebalanceMutex.Unlock()
+
+	orderIDs := make(map[uint64]struct{})
+	for _, id := range progress.OrderIDs {
+		orderIDs[id] = struct{}{}
+	}
+
+	var openOrders []types.Order
+	for _, symbol := range s.getSymbols() {
+		queryCtx, cancel := timeout.Context(ctx, s.Timeouts.Order.Duration())
+		orders, err := session.Exchange.QueryOpenOrders(queryCtx, symbol)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		for _, order := range orders {
+			if _, ok := orderIDs[order.OrderID]; ok || order.GroupID == s.groupID {
+				openOrders = append(openOrders, order)
+			}
+		}
+	}
+
+	// only the orders still open are tracked, the filled and cancelled ones are done
+	progress.OrderIDs = nil
+	for _, order := range openOrders {
+		progress.OrderIDs = append(progress.OrderIDs, order.OrderID)
+	}
+
+	if len(openOrders) > 0 {
+		log.Infof("resume the rebalance started at %s, re-attach %d open orders", progress.StartTime.Format(time.RFC3339), len(openOrders))
+		s.orderExecutor.Attach(openOrders...)
+	}
+
+	if len(progress.Pending) > 0 {
+		log.Infof("resume the rebalance started at %s, %d pending orders are submitted by the next trigger",
+			progress.StartTime.Format(time.RFC3339), len(progress.Pending))
+	}
+
+	s.saveProgress(progress)
+	if len(progress.OrderIDs) > 0 || len(progress.Pending) > 0 {
+		s.resumedProgress = progress
+	}
+	return nil
+}
+
+// finishResumedRebalance submits the pending orders of the resumed cycle at the latest prices,
+// the re-attached orders of the cycle are left open
+func (s *Strategy) finishResumedRebalance(ctx context.Context, session *bbgo.ExchangeSession, progress *rebalanceProgress) error {
+	if len(progress.Pending) == 0 {
+		log.Infof("the resumed rebalance has no pending orders, keep its %d open orders", len(progress.OrderIDs))
+		return nil
+	}
+
+	// the prices of the pending orders are stale after the restart
+	plan := &RebalancePlan{Orders: progress.Pending}
+	if err := s.repricePlan(ctx, plan); err != nil {
+		return err
+	}
+
+	for _, order := range plan.Orders {
+		log.Infof("resubmit pending order: %s", order.String())
+	}
+
+	_, err := s.submitOrders(ctx, session, progress, plan.Orders)
+	return err
+}
+
+// submitOrders submits the orders of the cycle and records the progress before and after the submission
+func (s *Strategy) submitOrders(ctx context.Context, session *bbgo.ExchangeSession, progress *rebalanceProgress, orders []types.SubmitOrder) (types.OrderSlice, error) {
+	progress.Pending = orders
+	s.saveProgress(progress)
+
+	if err := s.redeemForOrders(ctx, session, orders); err != nil {
+		return nil, err
+	}
+
+	submitCtx, cancel := timeout.Context(ctx, s.Timeouts.Order.Duration())
+	defer cancel()
+
+	createdOrders, err := s.orderExecutor.SubmitOrders(submitCtx, orders...)
+	for _, order := range createdOrders {
+		progress.OrderIDs = append(progress.OrderIDs, order.OrderID)
+	}
+	progress.Pending = unsubmittedOrders(orders, createdOrders)
+	s.saveProgress(progress)
+
+	return createdOrders, err
+}
+
+// unsubmittedOrders returns the orders without a created order of the same symbol and side
+func unsubmittedOrders(orders []types.SubmitOrder, createdOrders types.OrderSlice) (pending []types.SubmitOrder) {
+	created := make(map[string]int)
+	for _, order := range createdOrders {
+		created[order.Symbol+string(order.Side)]++
+	}
+
+	for _, order := range orders {
+		key := order.Symbol + string(order.Side)
+		if created[key] > 0 {
+			created[key]--
+			continue
+		}
+		pending = append(pending, order)
+	}
+	return pending
+}
@@ -0,0 +1,110 @@
+package marketcap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/execution"
+	"github.com/narumiruna/bbgo-marketcap/pricing"
+)
+
+func TestUnsubmittedOrders(t *testing.T) {
+	orders := []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeSell, Quantity: fixedpoint.NewFromFloat(0.1)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: fixedpoint.NewFromFloat(1)},
+		{Symbol: "ETHUSDT", Side: types.SideTypeBuy, Quantity: fixedpoint.NewFromFloat(2)},
+		{Symbol: "SOLUSDT", Side: types.SideTypeBuy, Quantity: fixedpoint.NewFromFloat(3)},
+	}
+
+	createdOrders := types.OrderSlice{
+		{SubmitOrder: types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeSell}, OrderID: 1},
+		{SubmitOrder: types.SubmitOrder{Symbol: "ETHUSDT", Side: types.SideTypeBuy}, OrderID: 2},
+	}
+
+	pending := unsubmittedOrders(orders, createdOrders)
+	if len(pending) != 2 {
+		t.Fatalf("pending orders %v, want 2 orders", pending)
+	}
+
+	// one of the ETH buys is created, the other one and the SOL buy are pending
+	if pending[0].Symbol != "ETHUSDT" || pending[1].Symbol != "SOLUSDT" {
+		t.Errorf("pending orders %v, want ETHUSDT and SOLUSDT", pending)
+	}
+}
+
+func TestUnsubmittedOrdersSide(t *testing.T) {
+	orders := []types.SubmitOrder{
+		{Symbol: "BTCUSDT", Side: types.SideTypeBuy},
+	}
+
+	// the created order of the other side does not match
+	createdOrders := types.OrderSlice{
+		{SubmitOrder: types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeSell}, OrderID: 1},
+	}
+
+	if pending := unsubmittedOrders(orders, createdOrders); len(pending) != 1 {
+		t.Errorf("pending orders %v, want the BTCUSDT buy", pending)
+	}
+}
+
+// recordingSubmitter records the submitted orders and creates them as new orders
+type recordingSubmitter struct {
+	bbgo.OrderExecutor
+
+	orders []types.SubmitOrder
+}
+
+func (r *recordingSubmitter) SubmitOrders(ctx context.Context, orders ...types.SubmitOrder) (types.OrderSlice, error) {
+	var createdOrders types.OrderSlice
+	for _, order := range orders {
+		r.orders = append(r.orders, order)
+		createdOrders = append(createdOrders, types.Order{SubmitOrder: order, OrderID: uint64(100 + len(r.orders))})
+	}
+	return createdOrders, nil
+}
+
+func TestRebalanceFinishesResumedCycle(t *testing.T) {
+	s, session := newPaperStrategy(nil)
+	s.Paper = nil
+	s.pricer = pricing.NewPricer(session.Exchange, time.Second)
+
+	submitter := &recordingSubmitter{}
+	s.orderExecutor = execution.NewOrderExecutor(session, submitter, s.getSymbols())
+
+	// the open order of the resumed cycle is re-attached, cancelling it would call the fake exchange and panic
+	s.orderExecutor.Attach(types.Order{
+		SubmitOrder: types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Quantity: number(1), Price: number(90)},
+		OrderID:     1,
+	})
+	progress := &rebalanceProgress{
+		OrderIDs: []uint64{1},
+		Pending: []types.SubmitOrder{
+			{Symbol: "ETHUSDT", Side: types.SideTypeSell, Type: types.OrderTypeLimit, Quantity: number(2), Price: number(5)},
+		},
+	}
+	s.resumedProgress = progress
+
+	if err := s.rebalance(context.Background(), session); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the pending order is submitted at the last price instead of the stale one
+	if len(submitter.orders) != 1 {
+		t.Fatalf("submitted orders %v, want the pending ETHUSDT sell", submitter.orders)
+	}
+	if order := submitter.orders[0]; order.Symbol != "ETHUSDT" || order.Price.Compare(number(10.5)) != 0 {
+		t.Errorf("submitted order %s @ %v, want ETHUSDT @ 10.5", order.Symbol, order.Price)
+	}
+
+	if len(progress.Pending) != 0 || len(progress.OrderIDs) != 2 {
+		t.Errorf("progress %+v, want no pending orders and 2 order ids", progress)
+	}
+	if s.resumedProgress != nil {
+		t.Error("the resumed cycle should be finished")
+	}
+}
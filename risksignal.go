@@ -0,0 +1,162 @@
+package marketcap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+)
+
+const (
+	IndicatorSMA = "sma"
+	IndicatorEMA = "ema"
+)
+
+// RiskSignalConfig drives the base weight by a moving average regime: the portfolio is risk-off and holds
+// riskOffWeight in the base currency when the close of the symbol is below its moving average, and holds
+// baseWeight otherwise.
+type RiskSignalConfig struct {
+	// Symbol is the market the regime is read from, BTC quoted in the base currency by default
+	Symbol string `json:"symbol"`
+	// Interval is the kline interval of the moving average, 1d by default
+	Interval types.Interval `json:"interval"`
+	// Indicator is the moving average, sma or ema
+	Indicator string `json:"indicator"`
+	// Window is the number of klines of the moving average, 200 by default
+	Window int `json:"window"`
+	// RiskOffWeight is the base weight in the risk-off regime, required and not less than baseWeight
+	RiskOffWeight fixedpoint.Value `json:"riskOffWeight"`
+}
+
+func (c *RiskSignalConfig) Defaults(symbol string) {
+	if len(c.Symbol) == 0 {
+		c.Symbol = symbol
+	}
+
+	if len(c.Interval) == 0 {
+		c.Interval = types.Interval1d
+	}
+
+	if len(c.Indicator) == 0 {
+		c.Indicator = IndicatorSMA
+	}
+
+	if c.Window == 0 {
+		c.Window = 200
+	}
+}
+
+func (c *RiskSignalConfig) Validate(baseWeight fixedpoint.Value) error {
+	if _, ok := types.SupportedIntervals[c.Interval]; !ok {
+		return fmt.Errorf("riskSignal.interval %q is not supported", c.Interval)
+	}
+
+	if c.Indicator != IndicatorSMA && c.Indicator != IndicatorEMA {
+		return fmt.Errorf("riskSignal.indicator should be %s or %s, got %q", IndicatorSMA, IndicatorEMA, c.Indicator)
+	}
+
+	if c.Window < 2 {
+		return fmt.Errorf("riskSignal.window should not less than 2")
+	}
+
+	if c.RiskOffWeight.Sign() <= 0 || c.RiskOffWeight.Compare(fixedpoint.One) > 0 {
+		return fmt.Errorf("riskSignal.riskOffWeight should be greater than 0%% and not greater than 100%%, got %s", c.RiskOffWeight.Percentage())
+	}
+
+	// the risk-off regime holds more cash, not less
+	if c.RiskOffWeight.Compare(baseWeight) < 0 {
+		return fmt.Errorf("riskSignal.riskOffWeight %s should not less than baseWeight %s", c.RiskOffWeight.Percentage(), baseWeight.Percentage())
+	}
+
+	return nil
+}
+
+// queryRiskOff returns true if the close of the last closed kline before now is below the moving average
+func (c *RiskSignalConfig) queryRiskOff(ctx context.Context, exchange types.Exchange, now time.Time) (bool, error) {
+	// the ema needs more history than its window to converge
+	limit := c.Window
+	if c.Indicator == IndicatorEMA && 2*c.Window < 1000 {
+		limit = 2 * c.Window
+	}
+
+	// one more kline for the open one, which is dropped
+	klines, err := exchange.QueryKLines(ctx, c.Symbol, c.Interval, types.KLineQueryOptions{Limit: limit + 1})
+	if err != nil {
+		return false, err
+	}
+
+	klines = closedKLines(klines, now)
+
+	if len(klines) < c.Window {
+		return false, fmt.Errorf("risk signal needs %d klines of %s, got %d", c.Window, c.Symbol, len(klines))
+	}
+
+	var average fixedpoint.Value
+	switch c.Indicator {
+	case IndicatorEMA:
+		average = ema(klines, c.Window)
+	default:
+		average = sma(klines[len(klines)-c.Window:])
+	}
+
+	last := klines[len(klines)-1].Close
+	log.Infof("risk signal: %s close %v, %s(%d) %v", c.Symbol, last, c.Indicator, c.Window, average)
+	return last.Compare(average) < 0, nil
+}
+
+func sma(klines []types.KLine) fixedpoint.Value {
+	sum := fixedpoint.Zero
+	for _, k := range klines {
+		sum = sum.Add(k.Close)
+	}
+	return sum.Div(fixedpoint.NewFromInt(int64(len(klines))))
+}
+
+// ema is seeded by the sma of the first window klines
+func ema(klines []types.KLine, window int) fixedpoint.Value {
+	multiplier := fixedpoint.NewFromFloat(2.0 / float64(window+1))
+	average := sma(klines[:window])
+	for _, k := range klines[window:] {
+		average = k.Close.Sub(average).Mul(multiplier).Add(average)
+	}
+	return average
+}
+
+// baseWeight returns the base weight of the current regime, baseWeight if no risk signal is set
+func (s *Strategy) baseWeight(ctx context.Context) (fixedpoint.Value, error) {
+	if s.RiskSignal == nil {
+		return s.BaseWeight, nil
+	}
+
+	ctx, cancel := timeout.Context(ctx, s.Timeouts.Ticker.Duration())
+	defer cancel()
+
+	riskOff, err := s.RiskSignal.queryRiskOff(ctx, s.session.Exchange, s.Clock.Now())
+	if err != nil {
+		return fixedpoint.Zero, err
+	}
+
+	s.statusMutex.Lock()
+	changed := s.riskOff != riskOff
+	s.riskOff = riskOff
+	s.statusMutex.Unlock()
+
+	baseWeight := s.BaseWeight
+	if riskOff {
+		baseWeight = s.RiskSignal.RiskOffWeight
+	}
+
+	if changed {
+		regime := "risk-on"
+		if riskOff {
+			regime = "risk-off"
+		}
+		s.notify("", fmt.Sprintf("%s switched to %s, base weight %s", s.InstanceID(), regime, baseWeight.Percentage()))
+	}
+
+	return baseWeight, nil
+}
@@ -0,0 +1,33 @@
+package marketcap
+
+import (
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+func TestRiskSignalValidate(t *testing.T) {
+	baseWeight := fixedpoint.NewFromFloat(0.05)
+
+	for _, tc := range []struct {
+		riskOffWeight fixedpoint.Value
+		valid         bool
+	}{
+		{fixedpoint.Zero, false},
+		{fixedpoint.NewFromFloat(0.01), false},
+		{baseWeight, true},
+		{fixedpoint.NewFromFloat(0.5), true},
+		{fixedpoint.NewFromFloat(1.5), false},
+	} {
+		config := RiskSignalConfig{RiskOffWeight: tc.riskOffWeight}
+		config.Defaults("BTCUSDT")
+
+		err := config.Validate(baseWeight)
+		if tc.valid && err != nil {
+			t.Errorf("riskOffWeight %s: unexpected error: %v", tc.riskOffWeight.String(), err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("riskOffWeight %s: expected an error", tc.riskOffWeight.String())
+		}
+	}
+}
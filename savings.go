@@ -0,0 +1,257 @@
+package marketcap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+)
+
+// SavingsService is implemented by the exchanges with savings (earn, flexible savings) products,
+// binance is supported by binanceSavings
+type SavingsService interface {
+	// QuerySavingsBalances returns the subscribed savings balances by currency
+	QuerySavingsBalances(ctx context.Context) (types.BalanceMap, error)
+	// RedeemSavings redeems amount of the currency from savings back to the spot account
+	RedeemSavings(ctx context.Context, currency string, amount fixedpoint.Value) error
+}
+
+func (s *Strategy) savingsService(session *bbgo.ExchangeSession) (SavingsService, error) {
+	if service, ok := session.Exchange.(SavingsService); ok {
+		return service, nil
+	}
+
+	if session.ExchangeName == types.ExchangeBinance {
+		return newBinanceSavings(session)
+	}
+
+	return nil, fmt.Errorf("exchange %s does not support savings", session.Exchange.Name())
+}
+
+// binanceSavings is the SavingsService of the binance flexible savings. The subscribed savings are listed in the
+// spot account balances as the LD prefixed assets, e.g. LDUSDT, and they are redeemed by the product of the asset.
+type binanceSavings struct {
+	account func() types.BalanceMap
+	client  *binance.Client
+}
+
+// newBinanceSavings creates the savings client by the credentials of the session, like the session creates its exchange
+func newBinanceSavings(session *bbgo.ExchangeSession) (*binanceSavings, error) {
+	key, secret := session.Key, session.Secret
+	if len(key) == 0 || len(secret) == 0 {
+		prefix := session.EnvVarPrefix
+		if len(prefix) == 0 {
+			prefix = session.ExchangeName.String()
+		}
+		prefix = strings.ToUpper(prefix)
+
+		key = os.Getenv(prefix + "_API_KEY")
+		secret = os.Getenv(prefix + "_API_SECRET")
+	}
+
+	if len(key) == 0 || len(secret) == 0 {
+		return nil, fmt.Errorf("binance savings needs the api key and secret of session %s", session.Name)
+	}
+
+	return &binanceSavings{
+		account: session.Account.Balances,
+		client:  binance.NewClient(key, secret),
+	}, nil
+}
+
+func (b *binanceSavings) QuerySavingsBalances(ctx context.Context) (types.BalanceMap, error) {
+	savings := make(types.BalanceMap)
+	for currency, balance := range b.account() {
+		asset := strings.TrimPrefix(currency, "LD")
+		if asset == currency || len(asset) == 0 {
+			continue
+		}
+
+		savings[asset] = types.Balance{Currency: asset, Available: balance.Total()}
+	}
+	return savings, nil
+}
+
+func (b *binanceSavings) RedeemSavings(ctx context.Context, currency string, amount fixedpoint.Value) error {
+	productID, err := b.queryProductID(ctx, currency)
+	if err != nil {
+		return err
+	}
+
+	return b.client.NewRedeemSavingsFlexibleProductService().
+		ProductId(productID).
+		Amount(amount.Float64()).
+		Type("FAST").
+		Do(ctx)
+}
+
+// queryProductID returns the redeemable flexible product of the currency
+func (b *binanceSavings) queryProductID(ctx context.Context, currency string) (string, error) {
+	const pageSize = 100
+
+	for page := int64(1); ; page++ {
+		products, err := b.client.NewListSavingsFlexibleProductsService().Current(page).Size(pageSize).Do(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		for _, product := range products {
+			if product.Asset == currency && product.CanRedeem {
+				return product.ProductId, nil
+			}
+		}
+
+		if len(products) < pageSize {
+			return "", fmt.Errorf("no redeemable flexible savings product of %s", currency)
+		}
+	}
+}
+
+// querySavingsBalances returns the savings balances if includeSavings is enabled, or nil otherwise
+func (s *Strategy) querySavingsBalances(ctx context.Context, session *bbgo.ExchangeSession) (types.BalanceMap, error) {
+	if !s.IncludeSavings {
+		return nil, nil
+	}
+
+	service, err := s.savingsService(session)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := timeout.Context(ctx, s.Timeouts.Order.Duration())
+	defer cancel()
+	return service.QuerySavingsBalances(ctx)
+}
+
+// redeemForOrders redeems just enough from savings so the spot balances can cover the orders
+func (s *Strategy) redeemForOrders(ctx context.Context, session *bbgo.ExchangeSession, orders []types.SubmitOrder) error {
+	if !s.IncludeSavings || len(orders) == 0 {
+		return nil
+	}
+
+	service, err := s.savingsService(session)
+	if err != nil {
+		return err
+	}
+
+	savings, err := s.querySavingsBalances(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	// the amount of each currency the orders need from the spot account
+	required := make(map[string]fixedpoint.Value)
+	for _, order := range orders {
+		market, ok := session.Market(order.Symbol)
+		if !ok {
+			return fmt.Errorf("market %s not found", order.Symbol)
+		}
+
+		switch order.Side {
+		case types.SideTypeSell:
+			required[market.BaseCurrency] = required[market.BaseCurrency].Add(order.Quantity)
+		case types.SideTypeBuy:
+			required[market.QuoteCurrency] = required[market.QuoteCurrency].Add(order.Quantity.Mul(order.Price))
+		}
+	}
+
+	spot := session.Account.Balances()
+	redeemed := make(map[string]fixedpoint.Value)
+	for currency, amount := range required {
+		shortfall := amount.Sub(spot[currency].Available)
+		if shortfall.Sign() <= 0 {
+			continue
+		}
+
+		redeemable := fixedpoint.Min(shortfall, savings[currency].Total())
+		if redeemable.Sign() <= 0 {
+			continue
+		}
+
+		log.Infof("redeem %s %s from savings for the orders", redeemable.String(), currency)
+
+		redeemCtx, cancel := timeout.Context(ctx, s.Timeouts.Order.Duration())
+		err := service.RedeemSavings(redeemCtx, currency, redeemable)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("redeem %s %s error: %w", redeemable.String(), currency, err)
+		}
+
+		redeemed[currency] = spot[currency].Available.Add(redeemable)
+	}
+
+	if len(redeemed) == 0 {
+		return nil
+	}
+
+	return s.waitForRedemption(ctx, session, redeemed)
+}
+
+// redemptionPollInterval is the interval the spot balances are polled at after redeeming
+var redemptionPollInterval = 2 * time.Second
+
+// waitForRedemption polls the spot balances until the redeemed amounts arrive, the exchanges settle the
+// redemption asynchronously, so the orders submitted right after it can fail for insufficient balance.
+func (s *Strategy) waitForRedemption(ctx context.Context, session *bbgo.ExchangeSession, expected map[string]fixedpoint.Value) error {
+	ctx, cancel := timeout.Context(ctx, s.Timeouts.Order.Duration())
+	defer cancel()
+
+	ticker := time.NewTicker(redemptionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		balances, err := session.Exchange.QueryAccountBalances(ctx)
+		if err == nil {
+			session.Account.UpdateBalances(balances)
+
+			arrived := true
+			for currency, amount := range expected {
+				if balances[currency].Available.Compare(amount) < 0 {
+					arrived = false
+					break
+				}
+			}
+
+			if arrived {
+				return nil
+			}
+		} else {
+			log.WithError(err).Warnf("can not query the balances after redeeming")
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the redeemed savings did not arrive in the spot account: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// addBalances returns the sum of the balances, the savings are counted as available
+func addBalances(balances, savings types.BalanceMap) types.BalanceMap {
+	if len(savings) == 0 {
+		return balances
+	}
+
+	merged := make(types.BalanceMap, len(balances))
+	for currency, balance := range balances {
+		merged[currency] = balance
+	}
+
+	for currency, saving := range savings {
+		balance := merged[currency]
+		balance.Currency = currency
+		balance.Available = balance.Available.Add(saving.Total())
+		merged[currency] = balance
+	}
+	return merged
+}
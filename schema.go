@@ -0,0 +1,354 @@
+package marketcap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+var (
+	fixedpointType = reflect.TypeOf(fixedpoint.Value(0))
+	durationType   = reflect.TypeOf(types.Duration(0))
+	intervalType   = reflect.TypeOf(types.Interval(""))
+)
+
+// Schema returns the JSON schema of the strategy config
+func Schema() map[string]interface{} {
+	schema := schemaOf(reflect.TypeOf(Strategy{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = ID
+	return schema
+}
+
+// strategyConfig has the fields of Strategy without its methods, to decode the config without recursion
+type strategyConfig Strategy
+
+// UnmarshalJSON checks the config against the schema before decoding it,
+// so unknown fields and values of wrong types are rejected instead of being ignored.
+func (s *Strategy) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	if err := validateSchema(Schema(), value, ""); err != nil {
+		return fmt.Errorf("invalid %s config: %w", ID, err)
+	}
+
+	if err := json.Unmarshal(data, (*strategyConfig)(s)); err != nil {
+		return err
+	}
+
+	if fields, ok := value.(map[string]interface{}); ok {
+		s.configKeys = make(map[string]bool, len(fields))
+		for key := range fields {
+			s.configKeys[key] = true
+		}
+	}
+	return nil
+}
+
+// schemaOf generates the JSON schema of t, only the json tagged fields of the structs are included
+func schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case fixedpointType:
+		// fixedpoint values can be numbers or strings like "2%" and "1_000"
+		return map[string]interface{}{"type": []interface{}{"number", "string"}}
+
+	case durationType:
+		return map[string]interface{}{"type": []interface{}{"number", "string"}}
+
+	case intervalType:
+		var intervals []interface{}
+		for interval := range types.SupportedIntervals {
+			intervals = append(intervals, interval.String())
+		}
+		sort.Slice(intervals, func(i, j int) bool {
+			return intervals[i].(string) < intervals[j].(string)
+		})
+		return map[string]interface{}{"type": "string", "enum": intervals}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		promoted := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+
+			// the fields of the untagged embedded structs are promoted, like encoding/json does
+			if isEmbeddedStruct(field) {
+				embedded, _ := schemaOf(field.Type)["properties"].(map[string]interface{})
+				for name, property := range embedded {
+					promoted[name] = property
+				}
+				continue
+			}
+
+			name := jsonFieldName(field)
+			if len(name) == 0 {
+				continue
+			}
+			properties[name] = schemaOf(field.Type)
+		}
+
+		// the fields of the outer struct take precedence over the promoted ones
+		for name, property := range promoted {
+			if _, ok := properties[name]; !ok {
+				properties[name] = property
+			}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	}
+
+	// no constraint
+	return map[string]interface{}{}
+}
+
+func isEmbeddedStruct(field reflect.StructField) bool {
+	if !field.Anonymous || len(field.Tag.Get("json")) > 0 {
+		return false
+	}
+
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		// encoding/json ignores the embedded pointers of the unexported struct types
+		if len(field.PkgPath) > 0 {
+			return false
+		}
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	if len(field.PkgPath) > 0 {
+		return ""
+	}
+
+	tag := field.Tag.Get("json")
+	if len(tag) == 0 || tag == "-" {
+		return ""
+	}
+
+	return strings.Split(tag, ",")[0]
+}
+
+// validateSchema validates the decoded JSON value against the subset of JSON schema generated by schemaOf
+func validateSchema(schema map[string]interface{}, value interface{}, path string) error {
+	// null is the zero value of every field
+	if value == nil {
+		return nil
+	}
+
+	if t, ok := schema["type"]; ok && !matchSchemaType(t, value) {
+		return fmt.Errorf("%s should be %s, got %v", fieldPath(path), describeSchemaType(t), value)
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s should be one of %v, got %v", fieldPath(path), enum, value)
+		}
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if property, ok := properties[key].(map[string]interface{}); ok {
+				if err := validateSchema(property, v[key], joinFieldPath(path, key)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return unknownFieldError(joinFieldPath(path, key), key, properties)
+				}
+
+			case map[string]interface{}:
+				if err := validateSchema(additional, v[key], joinFieldPath(path, key)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchSchemaType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case []interface{}:
+		for _, tt := range t {
+			if matchSchemaType(tt, value) {
+				return true
+			}
+		}
+		return false
+
+	case string:
+		switch t {
+		case "string":
+			_, ok := value.(string)
+			return ok
+
+		case "boolean":
+			_, ok := value.(bool)
+			return ok
+
+		case "number":
+			_, ok := value.(json.Number)
+			return ok
+
+		case "integer":
+			n, ok := value.(json.Number)
+			if !ok {
+				return false
+			}
+			_, err := n.Int64()
+			return err == nil
+
+		case "array":
+			_, ok := value.([]interface{})
+			return ok
+
+		case "object":
+			_, ok := value.(map[string]interface{})
+			return ok
+		}
+	}
+	return true
+}
+
+func describeSchemaType(t interface{}) string {
+	if ts, ok := t.([]interface{}); ok {
+		var names []string
+		for _, tt := range ts {
+			names = append(names, fmt.Sprint(tt))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func unknownFieldError(path, key string, properties map[string]interface{}) error {
+	suggestion := ""
+	minDistance := 4
+	for property := range properties {
+		if d := levenshtein(strings.ToLower(key), strings.ToLower(property)); d < minDistance ||
+			(d == minDistance && len(suggestion) > 0 && property < suggestion) {
+			minDistance = d
+			suggestion = property
+		}
+	}
+
+	if len(suggestion) > 0 {
+		return fmt.Errorf("unknown field %q, did you mean %q?", path, suggestion)
+	}
+	return fmt.Errorf("unknown field %q", path)
+}
+
+func fieldPath(path string) string {
+	if len(path) == 0 {
+		return "config"
+	}
+	return path
+}
+
+func joinFieldPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,58 @@
+package marketcap
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidation(t *testing.T) {
+	for _, c := range []struct {
+		config string
+		err    string
+	}{
+		{`{"targetCurrency": ["BTC"]}`, `unknown field "targetCurrency", did you mean "targetCurrencies"?`},
+		{`{"dryRun": "yes"}`, `dryRun should be boolean, got yes`},
+		{`{"targetCurrencies": ["BTC", 1]}`, `targetCurrencies[1] should be string, got 1`},
+		{`{"errorNotifyThreshold": 1.5}`, `errorNotifyThreshold should be integer, got 1.5`},
+		{`{"interval": "7m"}`, `interval should be one of`},
+		{`{"timeouts": {"order": "30s", "tickers": "10s"}}`, `unknown field "timeouts.tickers", did you mean "ticker"?`},
+	} {
+		var s Strategy
+		err := json.Unmarshal([]byte(c.config), &s)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: error = %v, want %q", c.config, err, c.err)
+		}
+	}
+}
+
+func TestSchemaValidConfig(t *testing.T) {
+	var s Strategy
+	config := `{"interval": "1h", "baseWeight": "2%", "threshold": 0.02, "targetCurrencies": ["BTC", "ETH"], "maxAmount": 1000}`
+	if err := json.Unmarshal([]byte(config), &s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSchemaEmbeddedPersistence(t *testing.T) {
+	var s Strategy
+	config := `{"targetCurrencies": ["BTC"], "persistence": {"type": "json", "store": "default"}}`
+	if err := json.Unmarshal([]byte(config), &s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s.Persistence == nil || s.Persistence.PersistenceSelector == nil {
+		t.Fatalf("persistence is not decoded")
+	}
+	if got := s.Persistence.PersistenceSelector.Type; got != "json" {
+		t.Errorf("persistence type = %q, want %q", got, "json")
+	}
+}
+
+func TestSchemaEmbeddedUnknownField(t *testing.T) {
+	var s Strategy
+	config := `{"persistence": {"type": "json", "stor": "default"}}`
+	if err := json.Unmarshal([]byte(config), &s); err == nil {
+		t.Fatalf("expected an unknown field error")
+	}
+}
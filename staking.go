@@ -0,0 +1,59 @@
+package marketcap
+
+import (
+	"fmt"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+func (s *Strategy) validateStakedBalances() error {
+	for currency, amount := range s.StakedBalances {
+		if amount.Sign() < 0 {
+			return fmt.Errorf("stakedBalances: %s should not less than 0", currency)
+		}
+
+		if !s.isTargetCurrency(currency) {
+			return fmt.Errorf("stakedBalances: %s is not in targetCurrencies", currency)
+		}
+	}
+	return nil
+}
+
+func (s *Strategy) isTargetCurrency(currency string) bool {
+	for _, c := range s.TargetCurrencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// addStakedQuantities counts the staked balances as held exposure
+func (s *Strategy) addStakedQuantities(quantities vector.Vector) vector.Vector {
+	for i, currency := range s.TargetCurrencies {
+		if staked, ok := s.StakedBalances[currency]; ok {
+			quantities[i] = quantities[i].Add(staked)
+		}
+	}
+	return quantities
+}
+
+// tradableQuantities returns the quantities the trading session can sell, which exclude the staked balances and
+// the balances of the aggregated sub-accounts. The shorts can be sold beyond the holdings by borrowing, so they are
+// left out. It's nil if the sells are not limited.
+func (s *Strategy) tradableQuantities(balances types.BalanceMap) map[string]fixedpoint.Value {
+	if len(s.StakedBalances) == 0 && len(s.subSessions) == 0 {
+		return nil
+	}
+
+	tradable := make(map[string]fixedpoint.Value, len(s.TargetCurrencies))
+	for _, currency := range s.TargetCurrencies {
+		if _, short := s.ShortWeights[currency]; !short {
+			tradable[currency] = fixedpoint.Max(balances[currency].Total(), fixedpoint.Zero)
+		}
+	}
+	return tradable
+}
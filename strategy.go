@@ -2,46 +2,231 @@ package marketcap
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math"
+	"hash/fnv"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/c9s/bbgo/pkg/bbgo"
 	"github.com/c9s/bbgo/pkg/datasource/glassnode"
 	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/interact"
+	"github.com/c9s/bbgo/pkg/service"
 	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/clock"
+	"github.com/narumiruna/bbgo-marketcap/execution"
+	"github.com/narumiruna/bbgo-marketcap/lots"
+	"github.com/narumiruna/bbgo-marketcap/pricing"
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+	"github.com/narumiruna/bbgo-marketcap/weights"
 )
 
 const ID = "marketcap"
 
 var log = logrus.WithField("strategy", ID)
 
+var currencyPattern = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+var errRebalanceInFlight = errors.New("a rebalance is already in flight")
+
 func init() {
 	bbgo.RegisterStrategy(ID, &Strategy{})
 }
 
 type Strategy struct {
+	*bbgo.Graceful
+	*bbgo.Persistence
+	Environment   *bbgo.Environment
 	Notifiability *bbgo.Notifiability
 	glassnode     *glassnode.DataSource
+	mvrv          weights.MVRVSource
 
 	Interval         types.Interval   `json:"interval"`
 	BaseCurrency     string           `json:"baseCurrency"`
 	BaseWeight       fixedpoint.Value `json:"baseWeight"`
 	TargetCurrencies []string         `json:"targetCurrencies"`
 	Threshold        fixedpoint.Value `json:"threshold"`
-	Verbose          bool             `json:"verbose"`
-	DryRun           bool             `json:"dryRun"`
+	// Preset expands a named basket into the unset targetCurrencies, maxWeight and baseWeight, e.g. top10-ex-stables
+	Preset string `json:"preset"`
+	// MaxWeight caps the target weight of each currency, the excess is redistributed to the others
+	MaxWeight fixedpoint.Value `json:"maxWeight"`
+	// RiskSignal switches the base weight to riskSignal.riskOffWeight when the market is below its moving average
+	RiskSignal *RiskSignalConfig `json:"riskSignal,omitempty"`
+	// LiquidityCap caps the target weight of each currency by days of its 24h volume
+	LiquidityCap *LiquidityCapConfig `json:"liquidityCap,omitempty"`
+	// MVRVTilt tilts the market cap weights by the MVRV ratios of the currencies
+	MVRVTilt *MVRVTiltConfig `json:"mvrvTilt,omitempty"`
+	// Band replaces threshold with a tolerance band per target weight, e.g. the 5/25 rule
+	Band *execution.Band `json:"band,omitempty"`
+	// Optimizer minimizes the trades by bringing the breached weights only back into their bands
+	Optimizer *execution.Optimizer `json:"optimizer,omitempty"`
+	// the minimal value difference in base currency to trade, used together with threshold
+	ThresholdAmount fixedpoint.Value `json:"thresholdAmount"`
+	Verbose         bool             `json:"verbose"`
+	DryRun          *bool            `json:"dryRun,omitempty"`
+	// Approval holds the orders of each cycle until an operator approves them
+	Approval *ApprovalConfig `json:"approval,omitempty"`
+	// Paper fills the orders against a simulated balance sheet at the live tickers, it takes precedence over dryRun
+	Paper *PaperConfig `json:"paper,omitempty"`
 	// max amount to buy or sell per order
 	MaxAmount fixedpoint.Value `json:"maxAmount"`
+	// IncludeSavings counts the savings balances in the weights and redeems them when the orders need spot balances,
+	// binance flexible savings are supported, or the exchange of the session should implement SavingsService
+	IncludeSavings bool `json:"includeSavings"`
+	// StakedBalances are the staked or locked amounts by currency, they count in the weights but are never sold
+	StakedBalances map[string]fixedpoint.Value `json:"stakedBalances"`
+	// AggregateSessions are the sub-account sessions of the same exchange counted in the portfolio,
+	// the orders are only submitted to the session the strategy runs on
+	AggregateSessions []string `json:"aggregateSessions"`
+	// HoldOnly are the target currencies counted in the value and the weights but never traded,
+	// e.g. vesting tokens, the other currencies are rebalanced within the rest of the portfolio
+	HoldOnly []string `json:"holdOnly"`
+	// ShortWeights are the negative target weights of the currencies shorted through margin borrowing,
+	// the long weights are scaled up by the short proceeds, the session should be a margin session
+	ShortWeights map[string]fixedpoint.Value `json:"shortWeights"`
+	// QuoteCurrencies prices and trades the currencies by another quote currency than the base currency,
+	// e.g. {"ALT": "BTC"} trades ALTBTC and values ALT by ALTBTC * BTC<baseCurrency>. The quote currency should be
+	// a target currency, whose orders are adjusted so the BTC spent or received by ALTBTC is bought or sold
+	QuoteCurrencies map[string]string `json:"quoteCurrencies"`
+	// SymbolTemplate builds the symbols from {asset} and {quote}, e.g. "{asset}-{quote}", "{asset}{quote}" by default
+	SymbolTemplate string `json:"symbolTemplate"`
+	// Symbols overrides the symbols of the currencies, e.g. {"BTC": "XBTUSD"}
+	Symbols map[string]string `json:"symbols"`
+	// PlannedWithdrawal is the amount of base currency kept out of the rebalance for a withdrawal,
+	// the amount set by the control API is persisted and overrides it after a restart
+	PlannedWithdrawal fixedpoint.Value `json:"plannedWithdrawal"`
+	// TaxLots tracks the acquisition lots and the realized gains of the trades for the tax reporting
+	TaxLots *TaxLotsConfig `json:"taxLots,omitempty"`
+	// DCA deploys the contributions of base currency with buy-only orders
+	DCA *DCAConfig `json:"dca,omitempty"`
+	// the interval to refresh the market caps in the background, the rebalance fails
+	// if the weights were not refreshed for two intervals
+	WeightsRefreshInterval types.Duration `json:"weightsRefreshInterval"`
+	// timeouts of the external calls
+	Timeouts TimeoutConfig `json:"timeouts"`
+	// notify after the number of consecutive rebalance failures, 3 by default and 0 disables the notifications
+	ErrorNotifyThreshold int `json:"errorNotifyThreshold"`
+	// route the notifications of trades, errors and daily summaries to different channels
+	NotificationRoutes NotificationRoutes `json:"notificationRoutes"`
+	// Deterministic drives the clock by the kline close time instead of the wall clock, enable it in backtests
+	Deterministic bool `json:"deterministic"`
+	// ControlServer exposes the control API over HTTP, disabled if not set
+	ControlServer *ControlServerConfig `json:"controlServer,omitempty"`
+
+	// Clock is the time source of the schedules, it can be injected before Run
+	Clock clock.Clock `json:"-"`
+
+	session          *bbgo.ExchangeSession
+	subSessions      []*bbgo.ExchangeSession
+	orderExecutor    *execution.OrderExecutor
+	planner          *execution.Planner
+	pricer           *pricing.Pricer
+	weighter         *weights.MarketCapWeighter
+	tilter           *weights.MVRVTilter
+	weightsRefresher *weights.Refresher
+
+	// sessionName is the name of the session the strategy is mounted on, set by Subscribe
+	sessionName string
+	groupID     uint32
+
+	// rebalanceMutex serializes the rebalances triggered by klines and the control API
+	rebalanceMutex sync.Mutex
+	// resumedProgress is the cycle resumed after a restart, it's finished by the next rebalance
+	resumedProgress *rebalanceProgress
+	// triggerRebalance runs a rebalance with the context, executor and session given to Run
+	triggerRebalance func() error
+
+	statusMutex       sync.Mutex
+	paused            bool
+	lastTargetWeights vector.Vector
+	lastPlan          *RebalancePlan
+	lastRebalanceTime time.Time
+	lastError         error
+	consecutiveErrors int
+	pendingApproval   chan bool
+	rebalancing       bool
+	riskOff           bool
+
+	dcaTracker dcaTracker
+	taxLots    taxLotTracker
+
+	paperAccount *paperAccount
+
+	beforeRebalanceHooks []BeforeRebalanceHook
+	afterRebalanceHooks  []AfterRebalanceHook
+	paperTradeHooks      []PaperTradeHook
+
+	// configKeys are the keys present in the config, to tell the explicit zero values from the unset ones
+	configKeys map[string]bool
+}
+
+// Defaults fills the unset fields with safe values, the strategy runs in dry run mode unless dryRun is set to false
+func (s *Strategy) Defaults() error {
+	if err := s.applyPreset(); err != nil {
+		return err
+	}
+
+	if len(s.Interval) == 0 {
+		s.Interval = types.Interval1d
+	}
+
+	if s.Band != nil {
+		s.Band.Defaults()
+	}
+
+	if s.Approval != nil {
+		s.Approval.Defaults()
+	}
+
+	if s.RiskSignal != nil {
+		symbol, _ := s.route("BTC")
+		s.RiskSignal.Defaults(symbol)
+	}
+
+	// the relative threshold is optional when the band or the absolute threshold is set
+	if s.Threshold.IsZero() && s.ThresholdAmount.IsZero() && s.Band == nil {
+		s.Threshold = fixedpoint.NewFromFloat(0.02)
+	}
+
+	if s.WeightsRefreshInterval == 0 {
+		s.WeightsRefreshInterval = types.Duration(time.Hour)
+	}
+
+	s.Timeouts.Defaults()
+
+	if s.TaxLots != nil && len(s.TaxLots.Method) == 0 {
+		s.TaxLots.Method = lots.FIFO
+	}
+
+	// an explicit 0 disables the error notifications
+	if s.ErrorNotifyThreshold == 0 && !s.configKeys["errorNotifyThreshold"] {
+		s.ErrorNotifyThreshold = 3
+	}
 
-	orderStore *bbgo.OrderStore
+	if s.DryRun == nil {
+		dryRun := true
+		s.DryRun = &dryRun
+	}
+
+	return nil
 }
 
 func (s *Strategy) Initialize() error {
+	if err := s.Defaults(); err != nil {
+		return err
+	}
+
 	apiKey := os.Getenv("GLASSNODE_API_KEY")
 	s.glassnode = glassnode.New(apiKey)
+	s.mvrv = newGlassnodeMVRV(apiKey)
 	return nil
 }
 
@@ -49,209 +234,619 @@ func (s *Strategy) ID() string {
 	return ID
 }
 
+// InstanceID identifies the configured instance of the strategy by the session,
+// the base currency and the hash of the target currencies, e.g. "marketcap:max:TWD:1a2b3c4d"
+func (s *Strategy) InstanceID() string {
+	return strings.Join([]string{ID, s.sessionName, s.BaseCurrency, s.basketHash()}, ":")
+}
+
+// accountID identifies the account state, e.g. the tax lots, which outlives the changes of the basket
+func (s *Strategy) accountID() string {
+	return strings.Join([]string{ID, s.sessionName, s.BaseCurrency}, ":")
+}
+
+// loadAccountState loads the account state saved under the account id, the state saved by the older versions
+// under the instance id is migrated on the first load
+func (s *Strategy) loadAccountState(val interface{}, subID string) error {
+	err := s.Persistence.Load(val, s.accountID(), subID)
+	if !errors.Is(err, service.ErrPersistenceNotExists) {
+		return err
+	}
+
+	if err := s.Persistence.Load(val, s.InstanceID(), subID); err != nil {
+		// report the missing state of the account rather than the legacy one
+		if errors.Is(err, service.ErrPersistenceNotExists) {
+			return service.ErrPersistenceNotExists
+		}
+		return err
+	}
+
+	log.Infof("migrate the %s state of %s to %s", subID, s.InstanceID(), s.accountID())
+	return s.Persistence.Save(val, s.accountID(), subID)
+}
+
+func (s *Strategy) basketHash() string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.Join(s.TargetCurrencies, ",")))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
 func (s *Strategy) Validate() error {
+	// the preset is expanded here as well in case the validation runs before the defaults
+	if err := s.applyPreset(); err != nil {
+		return err
+	}
+
+	if len(s.Interval) > 0 {
+		if _, ok := types.SupportedIntervals[s.Interval]; !ok {
+			return fmt.Errorf("interval %q is not supported", s.Interval)
+		}
+	}
+
+	if !currencyPattern.MatchString(s.BaseCurrency) {
+		return fmt.Errorf("baseCurrency %q should be an upper case currency code like USDT", s.BaseCurrency)
+	}
+
 	if len(s.TargetCurrencies) == 0 {
-		return fmt.Errorf("taretCurrencies should not be empty")
+		return fmt.Errorf("targetCurrencies should not be empty")
 	}
 
+	seen := make(map[string]struct{})
 	for _, c := range s.TargetCurrencies {
+		if !currencyPattern.MatchString(c) {
+			return fmt.Errorf("targetCurrencies: %q should be an upper case currency code like BTC", c)
+		}
+
 		if c == s.BaseCurrency {
 			return fmt.Errorf("targetCurrencies contain baseCurrency")
 		}
+
+		if _, ok := seen[c]; ok {
+			return fmt.Errorf("targetCurrencies: %s is duplicated", c)
+		}
+		seen[c] = struct{}{}
+	}
+
+	if s.BaseWeight.Sign() < 0 || s.BaseWeight.Compare(fixedpoint.One) > 0 {
+		return fmt.Errorf("baseWeight should be between 0%% and 100%%, got %s", s.BaseWeight.Percentage())
+	}
+
+	if s.MaxWeight.Sign() < 0 || s.MaxWeight.Compare(fixedpoint.One) > 0 {
+		return fmt.Errorf("maxWeight should be between 0%% and 100%%, got %s", s.MaxWeight.Percentage())
 	}
 
 	if s.Threshold < 0 {
 		return fmt.Errorf("threshold should not less than 0")
 	}
 
+	if s.Threshold.Compare(fixedpoint.One) > 0 {
+		return fmt.Errorf("threshold should not greater than 100%%, got %s", s.Threshold.Percentage())
+	}
+
+	if s.WeightsRefreshInterval < 0 {
+		return fmt.Errorf("weightsRefreshInterval should not less than 0")
+	}
+
+	if s.ErrorNotifyThreshold < 0 {
+		return fmt.Errorf("errorNotifyThreshold should not less than 0")
+	}
+
+	if s.Band != nil {
+		if err := s.Band.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.Optimizer != nil {
+		if err := s.Optimizer.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.ThresholdAmount.Sign() < 0 {
+		return fmt.Errorf("thresholdAmount should not less than 0")
+	}
+
 	if s.MaxAmount.Sign() < 0 {
 		return fmt.Errorf("maxAmount shoud not less than 0")
 	}
 
+	for currency, quote := range s.QuoteCurrencies {
+		if !s.isTargetCurrency(currency) {
+			return fmt.Errorf("quoteCurrencies: %s is not in targetCurrencies", currency)
+		}
+
+		if quote == currency || !currencyPattern.MatchString(quote) {
+			return fmt.Errorf("quoteCurrencies: %q is not a valid quote currency of %s", quote, currency)
+		}
+
+		// the cash of the quote currency is only tracked if it's in the portfolio
+		if quote != s.BaseCurrency && !s.isTargetCurrency(quote) {
+			return fmt.Errorf("quoteCurrencies: the quote currency %s of %s should be the base currency or in targetCurrencies", quote, currency)
+		}
+	}
+
+	if err := s.validateSymbols(); err != nil {
+		return err
+	}
+
+	if err := s.validateShortWeights(); err != nil {
+		return err
+	}
+
+	if err := s.validateStakedBalances(); err != nil {
+		return err
+	}
+
+	if err := s.validateHoldOnly(); err != nil {
+		return err
+	}
+
+	if s.PlannedWithdrawal.Sign() < 0 {
+		return fmt.Errorf("plannedWithdrawal should not less than 0")
+	}
+
+	if s.DCA != nil {
+		if err := s.DCA.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.TaxLots != nil {
+		if err := s.TaxLots.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.Approval != nil {
+		if err := s.Approval.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.RiskSignal != nil {
+		if err := s.RiskSignal.Validate(s.BaseWeight); err != nil {
+			return err
+		}
+	}
+
+	if s.LiquidityCap != nil {
+		if err := s.LiquidityCap.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.MVRVTilt != nil {
+		if err := s.MVRVTilt.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.Paper != nil {
+		if err := s.Paper.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (s *Strategy) Subscribe(session *bbgo.ExchangeSession) {
+	s.sessionName = session.Name
+
 	for _, symbol := range s.getSymbols() {
 		session.Subscribe(types.KLineChannel, symbol, types.SubscribeOptions{Interval: s.Interval.String()})
 	}
+
+	// the bot commands should be registered before the interaction starts, which is before Run
+	if s.Approval != nil {
+		interact.AddCustomInteraction(s)
+	}
+}
+
+// setup creates the components shared by Run and Preview
+func (s *Strategy) setup(session *bbgo.ExchangeSession) {
+	s.session = session
+	s.sessionName = session.Name
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s.InstanceID()))
+	s.groupID = h.Sum32()
+
+	if s.Clock == nil {
+		if s.Deterministic {
+			s.Clock = clock.NewManual(time.Time{})
+		} else {
+			s.Clock = clock.Real{}
+		}
+	}
+
+	s.planner = &execution.Planner{
+		Threshold:       s.Threshold,
+		ThresholdAmount: s.ThresholdAmount,
+		Band:            s.Band,
+		Optimizer:       s.Optimizer,
+		Markets:         session.Markets(),
+		MaxAmount:       s.MaxAmount,
+		GroupID:         s.groupID,
+	}
+
+	s.pricer = pricing.NewPricer(session.Exchange, s.Timeouts.Ticker.Duration())
+	s.weighter = weights.NewMarketCapWeighter(s.glassnode, s.Timeouts.DataSource.Duration())
+	s.tilter = weights.NewMVRVTilter(s.mvrv, s.Timeouts.DataSource.Duration())
+
+	if s.Paper != nil {
+		s.loadPaperAccount()
+	}
 }
 
 func (s *Strategy) Run(ctx context.Context, orderExecutor bbgo.OrderExecutor, session *bbgo.ExchangeSession) error {
-	s.orderStore = bbgo.NewOrderStore("")
-	s.orderStore.RemoveCancelled = true
-	s.orderStore.BindStream(session.UserDataStream)
+	if err := s.checkMarginSession(session); err != nil {
+		return err
+	}
 
-	session.MarketDataStream.OnKLineClosed(func(kline types.KLine) {
-		err := s.rebalance(ctx, orderExecutor, session)
-		if err != nil {
-			log.WithError(err)
+	subSessions, err := s.aggregateSessions(session)
+	if err != nil {
+		return err
+	}
+	s.subSessions = subSessions
+
+	s.setup(session)
+	s.loadPlannedWithdrawal()
+
+	s.orderExecutor = execution.NewOrderExecutor(session, orderExecutor, s.getSymbols())
+	s.orderExecutor.BindStream()
+	s.orderExecutor.OnTrade(s.notifyTrade)
+	if s.Paper != nil {
+		s.OnPaperTrade(s.notifyTrade)
+	}
+	if s.DCA != nil {
+		s.orderExecutor.OnTrade(s.handleDCATrade)
+	}
+	// the paper trades are simulated, they do not open or dispose of the tax lots
+	if s.TaxLots != nil && s.Paper == nil {
+		s.loadTaxLots()
+		s.orderExecutor.OnTrade(s.handleTaxLotTrade)
+	}
+
+	s.Graceful.OnShutdown(func(ctx context.Context, wg *sync.WaitGroup) {
+		defer wg.Done()
+
+		if err := s.orderExecutor.GracefulCancel(ctx); err != nil {
+			log.WithError(err).Errorf("graceful cancel orders error")
 		}
 	})
-	return nil
-}
 
-func (s *Strategy) getTargetWeights(ctx context.Context) (weights types.Float64Slice, err error) {
-	// get market cap values
-	for _, currency := range s.TargetCurrencies {
-		marketCap, err := s.glassnode.QueryMarketCapInUSD(ctx, currency)
-		if err != nil {
-			return nil, err
+	if s.Approval != nil {
+		s.OnBeforeRebalance(s.waitForApproval)
+	}
+
+	if err := s.resumeRebalance(ctx, session); err != nil {
+		log.WithError(err).Errorf("can not resume the rebalance")
+	}
+
+	// the manual clock should be seeded before the refresher schedules on it
+	s.seedClock(ctx, session)
+
+	s.weightsRefresher = weights.NewRefresher(s.Clock, s.WeightsRefreshInterval.Duration(), s.getTargetWeights)
+	s.weightsRefresher.Start(ctx)
+
+	go s.runDailySummary(ctx)
+
+	s.triggerRebalance = func() error {
+		// a rebalance waiting for approval holds the cycle, the later triggers are skipped instead of re-planning
+		if !s.startRebalance() {
+			return errRebalanceInFlight
 		}
-		weights = append(weights, marketCap)
+		defer s.finishRebalance()
+
+		err := s.rebalance(ctx, session)
+		s.handleRebalanceError(err)
+		return err
 	}
 
-	// normalize
-	weights = weights.Normalize()
+	// every target symbol closes a kline per interval, the first symbol triggers the rebalance once
+	triggerSymbol := s.getSymbols()[0]
+
+	session.MarketDataStream.OnKLineClosed(func(kline types.KLine) {
+		if manual, ok := s.Clock.(*clock.Manual); ok {
+			manual.Set(kline.EndTime.Time())
+		}
+
+		if kline.Symbol != triggerSymbol || kline.Interval != s.Interval {
+			return
+		}
+
+		if s.isPaused() {
+			log.Infof("strategy is paused, skip the rebalance")
+			return
+		}
 
-	// rescale by 1 - baseWeight
-	weights = weights.MulScalar(1.0 - s.BaseWeight.Float64())
+		// the approval can take a while, do not block the market data stream while waiting
+		if s.Approval != nil {
+			go s.triggerKLineRebalance()
+			return
+		}
 
-	// append base weight
-	weights = append(weights, s.BaseWeight.Float64())
+		s.triggerKLineRebalance()
+	})
 
-	return weights, nil
+	if s.ControlServer != nil {
+		if err := s.startControlServer(ctx, s.ControlServer); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *Strategy) rebalance(ctx context.Context, orderExecutor bbgo.OrderExecutor, session *bbgo.ExchangeSession) error {
-	err := orderExecutor.CancelOrders(ctx, s.orderStore.Orders()...)
+func (s *Strategy) rebalance(ctx context.Context, session *bbgo.ExchangeSession) (err error) {
+	s.rebalanceMutex.Lock()
+	defer s.rebalanceMutex.Unlock()
+
+	defer func() {
+		s.statusMutex.Lock()
+		s.lastError = err
+		s.statusMutex.Unlock()
+	}()
+
+	// the first trigger after a restart finishes the resumed cycle, its orders are still in flight
+	if progress := s.resumedProgress; progress != nil {
+		s.resumedProgress = nil
+		return s.finishResumedRebalance(ctx, session, progress)
+	}
+
+	cancelCtx, cancel := timeout.Context(ctx, s.Timeouts.Order.Duration())
+	err = s.orderExecutor.GracefulCancel(cancelCtx)
+	cancel()
 	if err != nil {
 		return err
 	}
 
-	prices, err := s.getPrices(ctx, session)
+	// the orders of the last cycle are cancelled, there is nothing to resume from it
+	s.clearProgress()
+
+	targetWeights, _, err := s.weightsRefresher.Weights()
 	if err != nil {
 		return err
 	}
 
-	targetWeights, err := s.getTargetWeights(ctx)
+	s.statusMutex.Lock()
+	s.lastTargetWeights = targetWeights
+	s.lastRebalanceTime = s.Clock.Now()
+	s.statusMutex.Unlock()
+
+	plan, err := s.buildPlan(ctx, session, targetWeights)
 	if err != nil {
 		return err
 	}
 
-	balances := session.Account.Balances()
-	quantities := s.getQuantities(balances)
-	marketValues := prices.Mul(quantities)
+	s.statusMutex.Lock()
+	s.lastPlan = plan
+	s.statusMutex.Unlock()
 
-	s.logAssets(marketValues, prices, quantities)
+	if err := s.emitBeforeRebalance(ctx, plan); err != nil {
+		log.WithError(err).Infof("rebalance is vetoed by the before rebalance hook")
+		return nil
+	}
 
-	orders := s.generateSubmitOrders(prices, marketValues, targetWeights)
-	for _, order := range orders {
+	for _, order := range plan.Orders {
 		log.Infof("generated submit order: %s", order.String())
 	}
 
-	if s.DryRun {
+	s.publishPlan(plan)
+
+	if s.Paper != nil {
+		s.paperAccount.updateValue(s.paperValue(plan))
+		filledOrders, err := s.fillPaperOrders(ctx, session, plan)
+		if err == nil && s.DCA != nil {
+			s.commitContribution(plan)
+		}
+		s.reportPaperPerformance(plan)
+		s.emitAfterRebalance(ctx, plan, filledOrders, err)
+		return err
+	}
+
+	if s.isDryRun() {
+		costs, totalCost := s.estimateCosts(ctx, session, plan)
+		s.logCosts(plan, costs, totalCost)
+		s.emitAfterRebalance(ctx, plan, nil, nil)
 		return nil
 	}
 
-	createdOrders, err := orderExecutor.SubmitOrders(ctx, orders...)
+	progress := &rebalanceProgress{StartTime: s.Clock.Now()}
+	createdOrders, err := s.submitOrders(ctx, session, progress, plan.Orders)
+
+	// the contribution is consumed only if it's submitted, a vetoed or failed cycle deploys it again
+	if err == nil && s.DCA != nil {
+		s.commitContribution(plan)
+	}
+
+	s.emitAfterRebalance(ctx, plan, createdOrders, err)
+	return err
+}
+
+func (s *Strategy) getTargetWeights(ctx context.Context) (vector.Vector, error) {
+	baseWeight, err := s.baseWeight(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	s.orderStore.Add(createdOrders...)
+	targetWeights, err := s.weighter.TargetWeights(ctx, s.TargetCurrencies, baseWeight)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	if s.MVRVTilt != nil {
+		targetWeights, err = s.tilter.Tilt(ctx, targetWeights, s.TargetCurrencies, s.MVRVTilt.Strength)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the shorts scale up the longs, so the max weight is applied after them
+	targetWeights = weights.WithShorts(targetWeights, s.TargetCurrencies, s.ShortWeights)
+
+	if s.MaxWeight.Sign() > 0 {
+		targetWeights = weights.Capped(targetWeights, s.MaxWeight)
+	}
+	return targetWeights, nil
 }
 
-func (s *Strategy) getPrices(ctx context.Context, session *bbgo.ExchangeSession) (types.Float64Slice, error) {
-	var prices types.Float64Slice
+// buildPlan prices the assets in the account and plans the orders to reach the target weights
+func (s *Strategy) buildPlan(ctx context.Context, session *bbgo.ExchangeSession, targetWeights vector.Vector) (*RebalancePlan, error) {
+	prices, symbolPrices, err := s.pricer.Prices(ctx, s.TargetCurrencies, s.BaseCurrency, s.route)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, currency := range s.TargetCurrencies {
-		symbol := currency + s.BaseCurrency
-		ticker, err := session.Exchange.QueryTicker(ctx, symbol)
-		if err != nil {
-			return prices, err
+	balances, err := s.balances(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	quantities := s.addStakedQuantities(s.getQuantities(s.addAggregatedBalances(balances)))
+
+	// carve out the planned withdrawal, a negative base quantity makes the plan sell assets to raise the cash
+	withdrawal := s.plannedWithdrawal()
+	if withdrawal.Sign() > 0 {
+		quantities[len(quantities)-1] = quantities[len(quantities)-1].Sub(withdrawal)
+		log.Infof("reserve %s %s for the planned withdrawal", withdrawal.String(), s.BaseCurrency)
+	}
+
+	// reserve the contribution of the DCA, the portfolio without it is rebalanced and the contribution is
+	// deployed by the target weights on top of the rebalance
+	var contribution *dcaCycle
+	plannedQuantities := quantities
+	if s.DCA != nil {
+		contribution = s.planContribution(quantities[len(quantities)-1], fixedpoint.Max(withdrawal, fixedpoint.Zero))
+		if contribution.Amount.Sign() > 0 {
+			plannedQuantities = quantities.Copy()
+			plannedQuantities[len(plannedQuantities)-1] = plannedQuantities[len(plannedQuantities)-1].Sub(contribution.Amount)
 		}
-		prices = append(prices, ticker.Last.Float64())
 	}
 
-	// append base currency price
-	prices = append(prices, 1.0)
+	marketValues := prices.Mul(plannedQuantities)
+
+	s.logAssets(prices.Mul(quantities), prices, quantities)
+
+	targetWeights, err = s.applyLiquidityCaps(ctx, session, targetWeights, prices, marketValues.Sum())
+	if err != nil {
+		return nil, err
+	}
+
+	targetWeights = weights.WithHoldOnly(targetWeights, marketValues.Normalize(), s.TargetCurrencies, s.HoldOnly)
+
+	orders := s.planner.Plan(s.getSymbols(), prices, symbolPrices, marketValues, targetWeights)
+
+	plan := &RebalancePlan{
+		TargetWeights:  targetWeights,
+		CurrentWeights: prices.Mul(quantities).Normalize(),
+		Prices:         prices,
+		SymbolPrices:   symbolPrices,
+		Quantities:     quantities,
+		Withdrawal:     fixedpoint.Max(withdrawal, fixedpoint.Zero),
+		contribution:   contribution,
+	}
+
+	if contribution != nil && contribution.Amount.Sign() > 0 {
+		log.Infof("deploy the contribution of %s %s by the target weights", contribution.Amount.String(), s.BaseCurrency)
+		plan.Contribution = contribution.Amount
+		orders = s.planner.MergeOrders(orders, s.planner.PlanContribution(s.getSymbols(), prices, symbolPrices, s.withoutHoldOnly(targetWeights), contribution.Amount))
+	}
 
-	return prices, nil
+	orders = s.planner.LimitSells(orders, s.tradableQuantities(balances))
+	plan.Orders = s.applyMarginSideEffects(s.planner.LimitBuys(orders, s.spendableCash(balances)))
+	return plan, nil
 }
 
-func (s *Strategy) getQuantities(balances types.BalanceMap) (quantities types.Float64Slice) {
-	for _, currency := range s.TargetCurrencies {
-		quantities = append(quantities, balances[currency].Total().Float64())
+// balances returns the account balances with the savings, or the simulated balances in the paper mode
+func (s *Strategy) balances(ctx context.Context, session *bbgo.ExchangeSession) (types.BalanceMap, error) {
+	if s.Paper != nil {
+		return s.paperAccount.balanceMap(), nil
 	}
 
-	// append base currency quantity
-	quantities = append(quantities, balances[s.BaseCurrency].Total().Float64())
+	savings, err := s.querySavingsBalances(ctx, session)
+	if err != nil {
+		return nil, err
+	}
 
-	return quantities
+	return addBalances(session.Account.Balances(), savings), nil
 }
 
-func (s *Strategy) generateSubmitOrders(prices, marketValues, targetWeights types.Float64Slice) (submitOrders []types.SubmitOrder) {
-	currentWeights := marketValues.Normalize()
-	totalValue := marketValues.Sum()
-
-	for i, currency := range s.TargetCurrencies {
-		symbol := currency + s.BaseCurrency
-		currentWeight := currentWeights[i]
-		currentPrice := prices[i]
-		targetWeight := targetWeights[i]
-
-		log.Infof("%s price: %v, current weight: %v, target weight: %v",
-			symbol,
-			currentPrice,
-			currentWeight,
-			targetWeight)
-
-		// calculate the difference between current weight and target weight
-		// if the difference is less than threshold, then we will not create the order
-		weightDifference := targetWeight - currentWeight
-		if math.Abs(weightDifference) < s.Threshold.Float64() {
-			log.Infof("%s weight distance |%v - %v| = |%v| less than the threshold: %v",
-				symbol,
-				currentWeight,
-				targetWeight,
-				weightDifference,
-				s.Threshold)
-			continue
-		}
+func (s *Strategy) isDryRun() bool {
+	return s.DryRun == nil || *s.DryRun
+}
 
-		quantity := fixedpoint.NewFromFloat((weightDifference * totalValue) / currentPrice)
+func (s *Strategy) isPaused() bool {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	return s.paused
+}
 
-		side := types.SideTypeBuy
-		if quantity.Sign() < 0 {
-			side = types.SideTypeSell
-			quantity = quantity.Abs()
-		}
+// triggerKLineRebalance runs the rebalance of a closed kline, the error is handled by triggerRebalance
+func (s *Strategy) triggerKLineRebalance() {
+	if err := s.triggerRebalance(); errors.Is(err, errRebalanceInFlight) {
+		log.Infof("the last rebalance is still in flight, skip the rebalance")
+	}
+}
 
-		if s.MaxAmount.Sign() > 0 {
-			quantity = bbgo.AdjustQuantityByMaxAmount(quantity, fixedpoint.NewFromFloat(currentPrice), s.MaxAmount)
-			log.Infof("adjust the quantity %v (%s %s @ %v) by max amount %v",
-				quantity,
-				symbol,
-				side.String(),
-				currentPrice,
-				s.MaxAmount)
-		}
+// startRebalance marks a rebalance in flight, it returns false if another rebalance is running
+func (s *Strategy) startRebalance() bool {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
 
-		order := types.SubmitOrder{
-			Symbol:   symbol,
-			Side:     side,
-			Type:     types.OrderTypeLimit,
-			Quantity: quantity,
-			Price:    fixedpoint.NewFromFloat(currentPrice),
-		}
+	if s.rebalancing {
+		return false
+	}
+	s.rebalancing = true
+	return true
+}
+
+func (s *Strategy) finishRebalance() {
+	s.statusMutex.Lock()
+	s.rebalancing = false
+	s.statusMutex.Unlock()
+}
+
+func (s *Strategy) setPaused(paused bool) {
+	s.statusMutex.Lock()
+	s.paused = paused
+	s.statusMutex.Unlock()
+}
 
-		submitOrders = append(submitOrders, order)
+func (s *Strategy) getQuantities(balances types.BalanceMap) (quantities vector.Vector) {
+	for _, currency := range s.TargetCurrencies {
+		quantities = append(quantities, netQuantity(balances[currency]))
 	}
-	return submitOrders
+
+	// append base currency quantity
+	quantities = append(quantities, netQuantity(balances[s.BaseCurrency]))
+
+	return quantities
 }
 
 func (s *Strategy) getSymbols() (symbols []string) {
 	for _, currency := range s.TargetCurrencies {
-		symbol := currency + s.BaseCurrency
+		symbol, _ := s.route(currency)
 		symbols = append(symbols, symbol)
 	}
 	return symbols
 }
 
-func (s *Strategy) logAssets(marketValues, prices, quantities types.Float64Slice) {
+// route returns the symbol the currency is traded and priced by, and the quote currency of the symbol
+func (s *Strategy) route(currency string) (symbol, quote string) {
+	quote = s.BaseCurrency
+	if q, ok := s.QuoteCurrencies[currency]; ok {
+		quote = q
+	}
+
+	if symbol, ok := s.Symbols[currency]; ok {
+		return symbol, quote
+	}
+	return formatSymbol(s.SymbolTemplate, currency, quote), quote
+}
+
+func (s *Strategy) logAssets(marketValues, prices, quantities vector.Vector) {
 	weights := marketValues.Normalize()
 
 	if len(weights)-1 != len(s.TargetCurrencies) {
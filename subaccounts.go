@@ -0,0 +1,82 @@
+package marketcap
+
+import (
+	"fmt"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// aggregateSessions returns the sessions whose balances are aggregated into the portfolio,
+// they should be sub-accounts of the same exchange as the trading session
+func (s *Strategy) aggregateSessions(session *bbgo.ExchangeSession) ([]*bbgo.ExchangeSession, error) {
+	if len(s.AggregateSessions) == 0 {
+		return nil, nil
+	}
+
+	if s.Environment == nil {
+		return nil, fmt.Errorf("aggregateSessions needs the environment")
+	}
+
+	var sessions []*bbgo.ExchangeSession
+	for _, name := range s.AggregateSessions {
+		if name == session.Name {
+			return nil, fmt.Errorf("aggregateSessions: %s is the trading session", name)
+		}
+
+		sub, ok := s.Environment.Session(name)
+		if !ok {
+			return nil, fmt.Errorf("aggregateSessions: session %s not found", name)
+		}
+
+		if sub.Exchange.Name() != session.Exchange.Name() {
+			return nil, fmt.Errorf("aggregateSessions: session %s is on %s, but the trading session is on %s",
+				name, sub.Exchange.Name(), session.Exchange.Name())
+		}
+
+		sessions = append(sessions, sub)
+	}
+	return sessions, nil
+}
+
+// addAggregatedBalances adds the balances of the aggregated sub-accounts to the balances of the trading session
+func (s *Strategy) addAggregatedBalances(balances types.BalanceMap) types.BalanceMap {
+	if len(s.subSessions) == 0 || s.Paper != nil {
+		return balances
+	}
+
+	merged := make(types.BalanceMap, len(balances))
+	for currency, balance := range balances {
+		merged[currency] = balance
+	}
+
+	for _, sub := range s.subSessions {
+		for currency, balance := range sub.Account.Balances() {
+			total := merged[currency]
+			total.Currency = currency
+			total.Available = total.Available.Add(balance.Available)
+			total.Locked = total.Locked.Add(balance.Locked)
+			total.Borrowed = total.Borrowed.Add(balance.Borrowed)
+			total.Interest = total.Interest.Add(balance.Interest)
+			merged[currency] = total
+		}
+	}
+	return merged
+}
+
+// spendableCash returns the quote balances the trading session can spend on the buys, the cash of the aggregated
+// sub-accounts is counted in the weights but can not be spent by the trading session. It's nil if the buys are
+// not limited.
+func (s *Strategy) spendableCash(balances types.BalanceMap) map[string]fixedpoint.Value {
+	if len(s.subSessions) == 0 || s.Paper != nil {
+		return nil
+	}
+
+	cash := make(map[string]fixedpoint.Value, len(s.TargetCurrencies))
+	for _, currency := range s.TargetCurrencies {
+		_, quote := s.route(currency)
+		cash[quote] = fixedpoint.Max(balances[quote].Available, fixedpoint.Zero)
+	}
+	return cash
+}
@@ -0,0 +1,36 @@
+package marketcap
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultSymbolTemplate = "{asset}{quote}"
+
+// formatSymbol builds the symbol of the asset quoted in quote by the template
+func formatSymbol(template, asset, quote string) string {
+	if len(template) == 0 {
+		template = defaultSymbolTemplate
+	}
+	return strings.NewReplacer("{asset}", asset, "{quote}", quote).Replace(template)
+}
+
+func (s *Strategy) validateSymbols() error {
+	if len(s.SymbolTemplate) > 0 &&
+		(!strings.Contains(s.SymbolTemplate, "{asset}") || !strings.Contains(s.SymbolTemplate, "{quote}")) {
+		return fmt.Errorf("symbolTemplate %q should contain {asset} and {quote}", s.SymbolTemplate)
+	}
+
+	// the quote currencies can be overridden as well, they are routed to the base currency for pricing
+	for currency, symbol := range s.Symbols {
+		if !currencyPattern.MatchString(currency) {
+			return fmt.Errorf("symbols: %q should be an upper case currency code like BTC", currency)
+		}
+
+		if len(symbol) == 0 {
+			return fmt.Errorf("symbols: the symbol of %s should not be empty", currency)
+		}
+	}
+
+	return nil
+}
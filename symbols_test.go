@@ -0,0 +1,57 @@
+package marketcap
+
+import "testing"
+
+func TestFormatSymbol(t *testing.T) {
+	for _, c := range []struct {
+		template string
+		want     string
+	}{
+		{"", "BTCUSDT"},
+		{"{asset}-{quote}", "BTC-USDT"},
+		{"{asset}_{quote}", "BTC_USDT"},
+		{"{quote}{asset}", "USDTBTC"},
+	} {
+		if got := formatSymbol(c.template, "BTC", "USDT"); got != c.want {
+			t.Errorf("template %q: symbol = %s, want %s", c.template, got, c.want)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	s := &Strategy{
+		BaseCurrency:    "USD",
+		SymbolTemplate:  "{asset}-{quote}",
+		Symbols:         map[string]string{"BTC": "XBTUSD"},
+		QuoteCurrencies: map[string]string{"ALT": "ETH"},
+	}
+
+	for _, c := range []struct {
+		currency string
+		symbol   string
+		quote    string
+	}{
+		// the explicit symbol takes precedence over the template
+		{"BTC", "XBTUSD", "USD"},
+		{"ETH", "ETH-USD", "USD"},
+		// the quote currency of the cross-quoted currency fills the template
+		{"ALT", "ALT-ETH", "ETH"},
+	} {
+		symbol, quote := s.route(c.currency)
+		if symbol != c.symbol || quote != c.quote {
+			t.Errorf("%s: route = %s %s, want %s %s", c.currency, symbol, quote, c.symbol, c.quote)
+		}
+	}
+}
+
+func TestValidateSymbols(t *testing.T) {
+	for _, s := range []*Strategy{
+		{SymbolTemplate: "{asset}USDT"},
+		{Symbols: map[string]string{"btc": "XBTUSD"}},
+		{Symbols: map[string]string{"BTC": ""}},
+	} {
+		if err := s.validateSymbols(); err == nil {
+			t.Errorf("%+v should be rejected", s)
+		}
+	}
+}
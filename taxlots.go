@@ -0,0 +1,179 @@
+package marketcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/service"
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/narumiruna/bbgo-marketcap/lots"
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+)
+
+type TaxLotsConfig struct {
+	// Method selects the lots a sell disposes of, fifo or lifo
+	Method lots.Method `json:"method"`
+	// ReportPath is the CSV file the lot-level report is written to after each trade
+	ReportPath string `json:"reportPath"`
+}
+
+func (c *TaxLotsConfig) Validate() error {
+	return c.Method.Validate()
+}
+
+// taxLotTracker records the trades of the strategy in a lot ledger and persists it
+type taxLotTracker struct {
+	mu     sync.Mutex
+	ledger *lots.Ledger
+}
+
+func (s *Strategy) loadTaxLots() {
+	ledger := lots.NewLedger(s.TaxLots.Method)
+
+	if s.Persistence != nil {
+		if err := s.loadAccountState(ledger, "lots"); err != nil {
+			if errors.Is(err, service.ErrPersistenceNotExists) {
+				log.Infof("no tax lots are found, start a new ledger")
+			} else {
+				log.WithError(err).Warnf("can not load the tax lots, start a new ledger")
+			}
+			ledger = lots.NewLedger(s.TaxLots.Method)
+		}
+	}
+
+	if ledger.Method != s.TaxLots.Method {
+		log.Warnf("tax lot method is changed from %s to %s, the existing lots are kept", ledger.Method, s.TaxLots.Method)
+		ledger.Method = s.TaxLots.Method
+	}
+
+	s.taxLots.ledger = ledger
+}
+
+func (s *Strategy) handleTaxLotTrade(trade types.Trade) {
+	if s.Paper != nil {
+		return
+	}
+
+	market, ok := s.session.Market(trade.Symbol)
+	if !ok {
+		return
+	}
+
+	currency := market.BaseCurrency
+	quote := market.QuoteCurrency
+	quantity := trade.Quantity
+	amount := trade.QuoteQuantity
+
+	// the fee paid in the quote currency adds to the cost or reduces the proceeds,
+	// the fee paid in the asset reduces the acquired quantity or adds to the disposed quantity
+	switch trade.FeeCurrency {
+	case quote:
+		if trade.Side == types.SideTypeBuy {
+			amount = amount.Add(trade.Fee)
+		} else {
+			amount = amount.Sub(trade.Fee)
+		}
+
+	case currency:
+		if trade.Side == types.SideTypeBuy {
+			quantity = quantity.Sub(trade.Fee)
+		} else {
+			quantity = quantity.Add(trade.Fee)
+		}
+	}
+
+	// the ledger is kept in the base currency, a trade quoted in another currency is valued by the price of the quote
+	value, err := s.baseValue(quote, amount)
+	if err != nil {
+		log.WithError(err).Errorf("can not value trade %d in %s, the tax lots skip it", trade.ID, s.BaseCurrency)
+		return
+	}
+
+	s.taxLots.mu.Lock()
+	defer s.taxLots.mu.Unlock()
+
+	ledger := s.taxLots.ledger
+	at := trade.Time.Time()
+
+	var realizations []lots.Realization
+	switch trade.Side {
+	case types.SideTypeBuy:
+		ledger.Buy(currency, quantity, value, at, trade.ID)
+
+		// the quote asset spent on the buy, e.g. the BTC of ALTBTC, is disposed of as well
+		if quote != s.BaseCurrency {
+			realizations = ledger.Sell(quote, amount, value, at, trade.ID)
+		}
+
+	case types.SideTypeSell:
+		realizations = ledger.Sell(currency, quantity, value, at, trade.ID)
+
+		if quote != s.BaseCurrency {
+			ledger.Buy(quote, amount, value, at, trade.ID)
+		}
+	}
+
+	for _, r := range realizations {
+		log.Infof("realized %s %s gain %s %s (cost basis %s, proceeds %s)",
+			r.Quantity.String(), r.Currency, r.Gain.String(), s.BaseCurrency, r.CostBasis.String(), r.Proceeds.String())
+	}
+
+	if s.Persistence != nil {
+		if err := s.Persistence.Save(ledger, s.accountID(), "lots"); err != nil {
+			log.WithError(err).Errorf("can not save the tax lots")
+		}
+	}
+
+	if len(s.TaxLots.ReportPath) > 0 {
+		if err := writeTaxLotReport(s.TaxLots.ReportPath, ledger); err != nil {
+			log.WithError(err).Errorf("can not write the tax lot report")
+		}
+	}
+}
+
+// baseValue values the amount of the currency in the base currency, by the prices of the last plan if available
+func (s *Strategy) baseValue(currency string, amount fixedpoint.Value) (fixedpoint.Value, error) {
+	if currency == s.BaseCurrency {
+		return amount, nil
+	}
+
+	s.statusMutex.Lock()
+	plan := s.lastPlan
+	s.statusMutex.Unlock()
+
+	if plan != nil {
+		for i, c := range s.TargetCurrencies {
+			if c == currency && i < len(plan.Prices) && plan.Prices[i].Sign() > 0 {
+				return amount.Mul(plan.Prices[i]), nil
+			}
+		}
+	}
+
+	ctx, cancel := timeout.Context(context.Background(), s.Timeouts.Ticker.Duration())
+	defer cancel()
+
+	prices, _, err := s.pricer.Prices(ctx, []string{currency}, s.BaseCurrency, s.route)
+	if err != nil {
+		return fixedpoint.Zero, err
+	}
+	return amount.Mul(prices[0]), nil
+}
+
+func writeTaxLotReport(path string, ledger *lots.Ledger) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := ledger.WriteCSV(f); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write %s error: %w", path, err)
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,16 @@
+// Package timeout bounds the external calls of the strategy by the configured timeouts
+package timeout
+
+import (
+	"context"
+	"time"
+)
+
+// Context derives a context with the timeout, the parent context is used as is if the timeout is not positive.
+// The cancel function should always be called.
+func Context(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
@@ -0,0 +1,41 @@
+package timeout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+	ctx, cancel := Context(context.Background(), time.Minute)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("deadline %v %v, want within a minute", deadline, ok)
+	}
+}
+
+func TestContextWithoutTimeout(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		ctx, cancel := Context(context.Background(), d)
+		if _, ok := ctx.Deadline(); ok {
+			t.Fatalf("timeout %s should not set a deadline", d)
+		}
+
+		cancel()
+		if ctx.Err() != context.Canceled {
+			t.Fatalf("timeout %s: cancel should cancel the context", d)
+		}
+	}
+}
+
+func TestContextExpires(t *testing.T) {
+	ctx, cancel := Context(context.Background(), time.Millisecond)
+	defer cancel()
+
+	<-ctx.Done()
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("got %v, want deadline exceeded", ctx.Err())
+	}
+}
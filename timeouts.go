@@ -0,0 +1,31 @@
+package marketcap
+
+import (
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// TimeoutConfig limits how long each kind of external call can take
+type TimeoutConfig struct {
+	// DataSource is the timeout of each market cap query
+	DataSource types.Duration `json:"dataSource"`
+	// Ticker is the timeout of each ticker query
+	Ticker types.Duration `json:"ticker"`
+	// Order is the timeout of the order submission and cancellation
+	Order types.Duration `json:"order"`
+}
+
+func (c *TimeoutConfig) Defaults() {
+	if c.DataSource == 0 {
+		c.DataSource = types.Duration(30 * time.Second)
+	}
+
+	if c.Ticker == 0 {
+		c.Ticker = types.Duration(10 * time.Second)
+	}
+
+	if c.Order == 0 {
+		c.Order = types.Duration(30 * time.Second)
+	}
+}
@@ -0,0 +1,92 @@
+package vector
+
+import (
+	"strings"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+// Vector is a slice of fixedpoint values for the element-wise weight and value arithmetic
+type Vector []fixedpoint.Value
+
+// New creates a vector of n zeros
+func New(n int) Vector {
+	v := make(Vector, n)
+	for i := range v {
+		v[i] = fixedpoint.Zero
+	}
+	return v
+}
+
+func FromFloat64s(fs []float64) Vector {
+	v := make(Vector, len(fs))
+	for i, f := range fs {
+		v[i] = fixedpoint.NewFromFloat(f)
+	}
+	return v
+}
+
+func (v Vector) Copy() Vector {
+	c := make(Vector, len(v))
+	copy(c, v)
+	return c
+}
+
+func (v Vector) Sum() fixedpoint.Value {
+	sum := fixedpoint.Zero
+	for _, x := range v {
+		sum = sum.Add(x)
+	}
+	return sum
+}
+
+// Normalize divides the elements by their sum, a vector of zeros is returned if the sum is zero
+func (v Vector) Normalize() Vector {
+	sum := v.Sum()
+	if sum.IsZero() {
+		return New(len(v))
+	}
+	return v.DivScalar(sum)
+}
+
+// Mul multiplies the elements of v and u, they should have the same length
+func (v Vector) Mul(u Vector) Vector {
+	out := make(Vector, len(v))
+	for i := range v {
+		out[i] = v[i].Mul(u[i])
+	}
+	return out
+}
+
+// Sub subtracts the elements of u from v, they should have the same length
+func (v Vector) Sub(u Vector) Vector {
+	out := make(Vector, len(v))
+	for i := range v {
+		out[i] = v[i].Sub(u[i])
+	}
+	return out
+}
+
+func (v Vector) MulScalar(x fixedpoint.Value) Vector {
+	out := make(Vector, len(v))
+	for i := range v {
+		out[i] = v[i].Mul(x)
+	}
+	return out
+}
+
+func (v Vector) DivScalar(x fixedpoint.Value) Vector {
+	out := make(Vector, len(v))
+	for i := range v {
+		out[i] = v[i].Div(x)
+	}
+	return out
+}
+
+func (v Vector) String() string {
+	var ss []string
+	for _, x := range v {
+		ss = append(ss, x.String())
+	}
+	return "[" + strings.Join(ss, ", ") + "]"
+}
@@ -0,0 +1,57 @@
+package weights
+
+import (
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+// Capped limits the weight of each currency to maxWeight, see CappedBy
+func Capped(weights vector.Vector, maxWeight fixedpoint.Value) vector.Vector {
+	caps := vector.New(len(weights) - 1)
+	for i := range caps {
+		caps[i] = maxWeight
+	}
+	return CappedBy(weights, caps)
+}
+
+// CappedBy limits the weight of each currency to its cap and redistributes the excess to the uncapped long
+// currencies by their weights. The excess goes to the base weight, the last element, if every currency is capped.
+func CappedBy(weights vector.Vector, caps vector.Vector) vector.Vector {
+	n := len(weights) - 1
+	capped := weights.Copy()
+	fixed := make([]bool, n)
+
+	for {
+		excess := fixedpoint.Zero
+		for i := 0; i < n; i++ {
+			if !fixed[i] && capped[i].Compare(caps[i]) > 0 {
+				excess = excess.Add(capped[i].Sub(caps[i]))
+				capped[i] = caps[i]
+				fixed[i] = true
+			}
+		}
+
+		if excess.IsZero() {
+			return capped
+		}
+
+		free := fixedpoint.Zero
+		for i := 0; i < n; i++ {
+			if !fixed[i] && capped[i].Sign() > 0 {
+				free = free.Add(capped[i])
+			}
+		}
+
+		if free.Sign() <= 0 {
+			capped[n] = capped[n].Add(excess)
+			return capped
+		}
+
+		for i := 0; i < n; i++ {
+			if !fixed[i] && capped[i].Sign() > 0 {
+				capped[i] = capped[i].Add(capped[i].Mul(excess).Div(free))
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package weights
+
+import (
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+func TestCapped(t *testing.T) {
+	// the excess of BTC goes to ETH and SOL by their weights, then ETH is capped too
+	weights := Capped(newVector(0.6, 0.3, 0.05, 0.05), fixedpoint.NewFromFloat(0.4))
+	checkWeights(t, weights, 0.4, 0.4, 0.15, 0.05)
+}
+
+func TestCappedAllCapped(t *testing.T) {
+	// every currency is capped, the excess goes to the base weight
+	weights := Capped(newVector(0.5, 0.4, 0.1), fixedpoint.NewFromFloat(0.3))
+	checkWeights(t, weights, 0.3, 0.3, 0.4)
+}
+
+func TestCappedBy(t *testing.T) {
+	// BTC is capped by its own cap and the excess goes to ETH, which has room under its cap
+	weights := CappedBy(newVector(0.6, 0.2, 0.2), newVector(0.3, 0.6))
+	checkWeights(t, weights, 0.3, 0.5, 0.2)
+}
+
+func TestCappedShortsUntouched(t *testing.T) {
+	// the shorts never receive the excess, so it goes to the base weight once ETH is capped too
+	weights := Capped(newVector(0.8, 0.3, -0.1, 0), fixedpoint.NewFromFloat(0.5))
+	checkWeights(t, weights, 0.5, 0.5, -0.1, 0.1)
+}
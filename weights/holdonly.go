@@ -0,0 +1,50 @@
+package weights
+
+import (
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+// WithHoldOnly pins the target weights of the hold-only currencies to their current weights, so they are never
+// traded, and rescales the other weights including the base weight so all the weights still sum to one.
+// The weights are ordered as the currencies with the base weight appended as the last element.
+func WithHoldOnly(weights, currentWeights vector.Vector, currencies []string, holdOnly []string) vector.Vector {
+	if len(holdOnly) == 0 {
+		return weights
+	}
+
+	held := make(map[string]struct{}, len(holdOnly))
+	for _, currency := range holdOnly {
+		held[currency] = struct{}{}
+	}
+
+	heldTarget := fixedpoint.Zero
+	heldCurrent := fixedpoint.Zero
+	for i, currency := range currencies {
+		if _, ok := held[currency]; ok {
+			heldTarget = heldTarget.Add(weights[i])
+			heldCurrent = heldCurrent.Add(currentWeights[i])
+		}
+	}
+
+	rest := fixedpoint.One.Sub(heldTarget)
+	if rest.Sign() <= 0 {
+		return weights
+	}
+
+	// the other weights share what the hold-only currencies leave in the same proportions as their targets
+	scale := fixedpoint.Max(fixedpoint.One.Sub(heldCurrent), fixedpoint.Zero).Div(rest)
+
+	pinned := weights.Copy()
+	for i := range pinned {
+		if i < len(currencies) {
+			if _, ok := held[currencies[i]]; ok {
+				pinned[i] = currentWeights[i]
+				continue
+			}
+		}
+		pinned[i] = pinned[i].Mul(scale)
+	}
+	return pinned
+}
@@ -0,0 +1,21 @@
+package weights
+
+import "testing"
+
+func TestWithHoldOnly(t *testing.T) {
+	targetWeights := newVector(0.5, 0.3, 0.2, 0)
+	currentWeights := newVector(0.4, 0.2, 0.4, 0)
+	weights := WithHoldOnly(targetWeights, currentWeights, []string{"BTC", "ETH", "MATIC"}, []string{"MATIC"})
+
+	// MATIC stays at its current weight and the others share the rest by their targets
+	checkWeights(t, weights, 0.375, 0.225, 0.4, 0)
+}
+
+func TestWithHoldOnlyBase(t *testing.T) {
+	targetWeights := newVector(0.45, 0.45, 0.1)
+	currentWeights := newVector(0.2, 0.7, 0.1)
+	weights := WithHoldOnly(targetWeights, currentWeights, []string{"BTC", "ETH"}, []string{"ETH"})
+
+	// the base weight is rescaled with the other weights
+	checkWeights(t, weights, 0.245454, 0.7, 0.054545)
+}
@@ -0,0 +1,86 @@
+package weights
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/narumiruna/bbgo-marketcap/clock"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+// Refresher fetches the target weights in the background and serves the cached weights,
+// so the rebalance never waits for the data source.
+type Refresher struct {
+	clock    clock.Clock
+	interval time.Duration
+	fetch    func(ctx context.Context) (vector.Vector, error)
+
+	mu        sync.Mutex
+	weights   vector.Vector
+	updatedAt time.Time
+}
+
+func NewRefresher(clk clock.Clock, interval time.Duration, fetch func(ctx context.Context) (vector.Vector, error)) *Refresher {
+	return &Refresher{
+		clock:    clk,
+		interval: interval,
+		fetch:    fetch,
+	}
+}
+
+// Start schedules the refreshes on the clock before it returns, and refreshes the weights immediately
+// and then on every interval in the background until ctx is done
+func (r *Refresher) Start(ctx context.Context) {
+	ticker := r.clock.NewTicker(r.interval)
+	go r.run(ctx, ticker)
+}
+
+func (r *Refresher) run(ctx context.Context, ticker clock.Ticker) {
+	defer ticker.Stop()
+
+	r.refresh(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C():
+			r.refresh(ctx)
+		}
+	}
+}
+
+func (r *Refresher) refresh(ctx context.Context) {
+	weights, err := r.fetch(ctx)
+	if err != nil {
+		log.WithError(err).Errorf("refresh target weights error")
+		return
+	}
+
+	r.mu.Lock()
+	r.weights = weights
+	r.updatedAt = r.clock.Now()
+	r.mu.Unlock()
+
+	log.Infof("target weights refreshed: %v", weights)
+}
+
+// Weights returns a copy of the cached weights and the time they were fetched,
+// it returns an error if the last refresh is older than two intervals, e.g. the data source keeps failing
+func (r *Refresher) Weights() (vector.Vector, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.weights) == 0 {
+		return nil, time.Time{}, fmt.Errorf("target weights are not available yet")
+	}
+
+	if age := r.clock.Now().Sub(r.updatedAt); age > 2*r.interval {
+		return nil, r.updatedAt, fmt.Errorf("target weights are stale, last refreshed at %s (%s ago)", r.updatedAt, age)
+	}
+
+	return r.weights.Copy(), r.updatedAt, nil
+}
@@ -0,0 +1,110 @@
+package weights
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/clock"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRefresherManualClock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewManual(start)
+
+	var mu sync.Mutex
+	fetches := 0
+	r := NewRefresher(c, time.Hour, func(ctx context.Context) (vector.Vector, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		return vector.Vector{fixedpoint.NewFromInt(int64(fetches))}, nil
+	})
+	r.Start(ctx)
+
+	fetched := func(n int) func() bool {
+		return func() bool {
+			_, updatedAt, err := r.Weights()
+			mu.Lock()
+			defer mu.Unlock()
+			return err == nil && fetches == n && !updatedAt.IsZero()
+		}
+	}
+
+	waitFor(t, fetched(1))
+	_, updatedAt, _ := r.Weights()
+	if !updatedAt.Equal(start) {
+		t.Fatalf("updated at %s, want %s", updatedAt, start)
+	}
+
+	// the ticker is scheduled by Start, so a refresh is due exactly one interval later
+	c.Advance(time.Hour)
+	waitFor(t, fetched(2))
+
+	weights, updatedAt, _ := r.Weights()
+	if !updatedAt.Equal(start.Add(time.Hour)) {
+		t.Fatalf("updated at %s, want %s", updatedAt, start.Add(time.Hour))
+	}
+	if weights[0].Compare(fixedpoint.NewFromInt(2)) != 0 {
+		t.Fatalf("weights %v, want the second fetch", weights)
+	}
+}
+
+func TestRefresherStaleWeights(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := clock.NewManual(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var mu sync.Mutex
+	var fetchErr error
+	r := NewRefresher(c, time.Hour, func(ctx context.Context) (vector.Vector, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return vector.Vector{fixedpoint.One}, nil
+	})
+	r.Start(ctx)
+
+	waitFor(t, func() bool {
+		_, _, err := r.Weights()
+		return err == nil
+	})
+
+	mu.Lock()
+	fetchErr = fmt.Errorf("data source is down")
+	mu.Unlock()
+
+	// the failed refreshes keep the cached weights until they are two intervals old
+	c.Advance(time.Hour)
+	c.Advance(time.Hour)
+	if _, _, err := r.Weights(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c.Advance(time.Minute)
+	if _, _, err := r.Weights(); err == nil {
+		t.Fatal("expected an error for the stale weights")
+	}
+}
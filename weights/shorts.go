@@ -0,0 +1,40 @@
+package weights
+
+import (
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+// WithShorts overrides the target weights of the short currencies with their negative weights and rescales
+// the long weights so all the weights still sum to one, the proceeds of the shorts fund the longs.
+// The weights are ordered as the currencies with the base weight appended as the last element.
+func WithShorts(weights vector.Vector, currencies []string, shorts map[string]fixedpoint.Value) vector.Vector {
+	if len(shorts) == 0 {
+		return weights
+	}
+
+	baseWeight := weights[len(weights)-1]
+
+	longs := weights.Copy()
+	shortSum := fixedpoint.Zero
+	for i, currency := range currencies {
+		if short, ok := shorts[currency]; ok {
+			longs[i] = fixedpoint.Zero
+			shortSum = shortSum.Add(short)
+		}
+	}
+
+	// the base weight is excluded from the normalization
+	longs = longs[:len(currencies)].Normalize()
+
+	// longs + shorts + base = 1
+	longs = longs.MulScalar(fixedpoint.One.Sub(baseWeight).Sub(shortSum))
+	for i, currency := range currencies {
+		if short, ok := shorts[currency]; ok {
+			longs[i] = short
+		}
+	}
+
+	return append(longs, baseWeight)
+}
@@ -0,0 +1,44 @@
+package weights
+
+import (
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+func newVector(values ...float64) vector.Vector {
+	v := vector.New(len(values))
+	for i, value := range values {
+		v[i] = fixedpoint.NewFromFloat(value)
+	}
+	return v
+}
+
+func checkWeights(t *testing.T, got vector.Vector, want ...float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("weights %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i].Sub(fixedpoint.NewFromFloat(want[i])).Abs().Compare(fixedpoint.NewFromFloat(1e-6)) > 0 {
+			t.Fatalf("weights %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWithShorts(t *testing.T) {
+	shorts := map[string]fixedpoint.Value{"SOL": fixedpoint.NewFromFloat(-0.1)}
+	weights := WithShorts(newVector(0.6, 0.2, 0.1, 0.1), []string{"BTC", "ETH", "SOL"}, shorts)
+
+	// the longs share 1 - 0.1 + 0.1 by their weights
+	checkWeights(t, weights, 0.75, 0.25, -0.1, 0.1)
+}
+
+func TestWithShortsNone(t *testing.T) {
+	weights := WithShorts(newVector(0.6, 0.3, 0.1), []string{"BTC", "ETH"}, nil)
+	checkWeights(t, weights, 0.6, 0.3, 0.1)
+}
@@ -0,0 +1,70 @@
+package weights
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+// MVRVSource provides the MVRV ratios (market value to realized value) of the currencies
+type MVRVSource interface {
+	QueryMVRV(ctx context.Context, currency string) (float64, error)
+}
+
+// MVRVTilter tilts the weights away from the currencies with extreme MVRV towards the depressed ones
+type MVRVTilter struct {
+	source  MVRVSource
+	timeout time.Duration
+}
+
+// NewMVRVTilter creates a tilter, each MVRV query is limited by timeout if it's positive
+func NewMVRVTilter(source MVRVSource, timeout time.Duration) *MVRVTilter {
+	return &MVRVTilter{
+		source:  source,
+		timeout: timeout,
+	}
+}
+
+// Tilt multiplies the weight of each currency by MVRV^-strength and renormalizes the currency weights to their
+// original sum, the base weight, the last element, is kept. A strength of 0 leaves the weights unchanged.
+func (t *MVRVTilter) Tilt(ctx context.Context, weights vector.Vector, currencies []string, strength fixedpoint.Value) (vector.Vector, error) {
+	n := len(weights) - 1
+	total := weights[:n].Sum()
+
+	tilted := weights.Copy()
+	for i, currency := range currencies {
+		mvrv, err := t.queryMVRV(ctx, currency)
+		if err != nil {
+			return nil, err
+		}
+
+		if mvrv <= 0 {
+			return nil, fmt.Errorf("mvrv of %s should be positive, got %v", currency, mvrv)
+		}
+
+		tilted[i] = tilted[i].Mul(fixedpoint.NewFromFloat(math.Pow(mvrv, -strength.Float64())))
+	}
+
+	sum := tilted[:n].Sum()
+	if sum.Sign() <= 0 {
+		return weights, nil
+	}
+
+	for i := 0; i < n; i++ {
+		tilted[i] = tilted[i].Mul(total).Div(sum)
+	}
+	return tilted, nil
+}
+
+func (t *MVRVTilter) queryMVRV(ctx context.Context, currency string) (float64, error) {
+	ctx, cancel := timeout.Context(ctx, t.timeout)
+	defer cancel()
+
+	return t.source.QueryMVRV(ctx, currency)
+}
@@ -0,0 +1,50 @@
+package weights
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+type fakeMVRV map[string]float64
+
+func (f fakeMVRV) QueryMVRV(ctx context.Context, currency string) (float64, error) {
+	mvrv, ok := f[currency]
+	if !ok {
+		return 0, fmt.Errorf("no mvrv of %s", currency)
+	}
+	return mvrv, nil
+}
+
+func TestMVRVTilt(t *testing.T) {
+	tilter := NewMVRVTilter(fakeMVRV{"BTC": 4, "ETH": 1}, 0)
+	currencies := []string{"BTC", "ETH"}
+
+	// BTC is multiplied by 4^-0.5 and the currency weights are renormalized to 0.9, the base weight is kept
+	weights, err := tilter.Tilt(context.Background(), newVector(0.45, 0.45, 0.1), currencies, fixedpoint.NewFromFloat(0.5))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkWeights(t, weights, 0.3, 0.6, 0.1)
+
+	// a strength of 0 leaves the weights unchanged
+	weights, err = tilter.Tilt(context.Background(), newVector(0.45, 0.45, 0.1), currencies, fixedpoint.Zero)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkWeights(t, weights, 0.45, 0.45, 0.1)
+}
+
+func TestMVRVTiltInvalid(t *testing.T) {
+	for _, source := range []fakeMVRV{
+		{"BTC": 2},
+		{"BTC": 2, "ETH": 0},
+	} {
+		tilter := NewMVRVTilter(source, 0)
+		if _, err := tilter.Tilt(context.Background(), newVector(0.45, 0.45, 0.1), []string{"BTC", "ETH"}, fixedpoint.One); err == nil {
+			t.Errorf("mvrv %v should be rejected", source)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package weights
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+
+	"github.com/narumiruna/bbgo-marketcap/timeout"
+	"github.com/narumiruna/bbgo-marketcap/vector"
+)
+
+var log = logrus.WithFields(logrus.Fields{"strategy": "marketcap", "component": "weights"})
+
+// MarketCapSource provides the market caps of the currencies, e.g. glassnode.DataSource
+type MarketCapSource interface {
+	QueryMarketCapInUSD(ctx context.Context, currency string) (float64, error)
+}
+
+// MarketCapWeighter weights the currencies by their market caps
+type MarketCapWeighter struct {
+	source  MarketCapSource
+	timeout time.Duration
+}
+
+// NewMarketCapWeighter creates a weighter, each market cap query is limited by timeout if it's positive
+func NewMarketCapWeighter(source MarketCapSource, timeout time.Duration) *MarketCapWeighter {
+	return &MarketCapWeighter{
+		source:  source,
+		timeout: timeout,
+	}
+}
+
+// TargetWeights returns the market cap weights of the currencies rescaled by 1 - baseWeight,
+// the base weight is appended as the last element.
+func (w *MarketCapWeighter) TargetWeights(ctx context.Context, currencies []string, baseWeight fixedpoint.Value) (weights vector.Vector, err error) {
+	// get market cap values
+	var marketCaps []float64
+	for _, currency := range currencies {
+		marketCap, err := w.queryMarketCap(ctx, currency)
+		if err != nil {
+			return nil, err
+		}
+		marketCaps = append(marketCaps, marketCap)
+	}
+
+	// normalize
+	weights = normalizeMarketCaps(marketCaps)
+
+	// rescale by 1 - baseWeight
+	weights = weights.MulScalar(fixedpoint.One.Sub(baseWeight))
+
+	// append base weight
+	weights = append(weights, baseWeight)
+
+	return weights, nil
+}
+
+// normalizeMarketCaps normalizes the market caps in float64, the USD market caps overflow
+// the fixedpoint values above about 9.2e10, so only the weights are converted
+func normalizeMarketCaps(marketCaps []float64) vector.Vector {
+	sum := 0.0
+	for _, marketCap := range marketCaps {
+		sum += marketCap
+	}
+
+	weights := vector.New(len(marketCaps))
+	if sum <= 0 {
+		return weights
+	}
+
+	for i, marketCap := range marketCaps {
+		weights[i] = fixedpoint.NewFromFloat(marketCap / sum)
+	}
+	return weights
+}
+
+func (w *MarketCapWeighter) queryMarketCap(ctx context.Context, currency string) (float64, error) {
+	ctx, cancel := timeout.Context(ctx, w.timeout)
+	defer cancel()
+
+	marketCap, err := w.source.QueryMarketCapInUSD(ctx, currency)
+	if err != nil {
+		return 0, err
+	}
+
+	if marketCap < 0 || math.IsNaN(marketCap) || math.IsInf(marketCap, 0) {
+		return 0, fmt.Errorf("invalid market cap of %s: %v", currency, marketCap)
+	}
+	return marketCap, nil
+}
@@ -0,0 +1,44 @@
+package weights
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+)
+
+type fakeMarketCaps map[string]float64
+
+func (f fakeMarketCaps) QueryMarketCapInUSD(ctx context.Context, currency string) (float64, error) {
+	marketCap, ok := f[currency]
+	if !ok {
+		return 0, fmt.Errorf("no market cap of %s", currency)
+	}
+	return marketCap, nil
+}
+
+func TestTargetWeightsLargeMarketCaps(t *testing.T) {
+	// real USD market caps overflow the fixedpoint values
+	source := fakeMarketCaps{"BTC": 8e11, "ETH": 2e11}
+	w := NewMarketCapWeighter(source, 0)
+
+	weights, err := w.TargetWeights(context.Background(), []string{"BTC", "ETH"}, fixedpoint.NewFromFloat(0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []float64{0.72, 0.18, 0.1}
+	for i, weight := range weights {
+		if weight.Sign() < 0 || weight.Sub(fixedpoint.NewFromFloat(want[i])).Abs().Compare(fixedpoint.NewFromFloat(1e-8)) > 0 {
+			t.Fatalf("weights %v, want %v", weights, want)
+		}
+	}
+}
+
+func TestTargetWeightsInvalidMarketCap(t *testing.T) {
+	w := NewMarketCapWeighter(fakeMarketCaps{"BTC": -1}, 0)
+	if _, err := w.TargetWeights(context.Background(), []string{"BTC"}, fixedpoint.Zero); err == nil {
+		t.Fatal("negative market cap should be rejected")
+	}
+}
@@ -0,0 +1,67 @@
+package marketcap
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/service"
+)
+
+// withdrawalState is the planned withdrawal set by the control API, it's persisted so it survives restarts
+type withdrawalState struct {
+	Amount fixedpoint.Value `json:"amount"`
+}
+
+// PlanWithdrawal reserves amount of the base currency for a planned withdrawal, the reserved amount is excluded
+// from the portfolio so the rebalance sells the assets down to the targets while keeping the amount in cash.
+// A zero amount cancels the planned withdrawal. The amount is persisted and takes precedence over the config.
+func (s *Strategy) PlanWithdrawal(amount fixedpoint.Value) error {
+	if amount.Sign() < 0 {
+		return fmt.Errorf("withdrawal amount should not less than 0")
+	}
+
+	s.statusMutex.Lock()
+	s.PlannedWithdrawal = amount
+	s.statusMutex.Unlock()
+
+	if s.Persistence != nil {
+		if err := s.Persistence.Save(&withdrawalState{Amount: amount}, s.accountID(), "withdrawal"); err != nil {
+			log.WithError(err).Errorf("can not save the planned withdrawal")
+		}
+	}
+
+	if amount.IsZero() {
+		log.Infof("planned withdrawal is cancelled")
+	} else {
+		log.Infof("planned withdrawal of %s %s", amount.String(), s.BaseCurrency)
+	}
+	return nil
+}
+
+func (s *Strategy) plannedWithdrawal() fixedpoint.Value {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	return s.PlannedWithdrawal
+}
+
+// loadPlannedWithdrawal restores the planned withdrawal set by the control API before the restart
+func (s *Strategy) loadPlannedWithdrawal() {
+	if s.Persistence == nil {
+		return
+	}
+
+	var state withdrawalState
+	if err := s.Persistence.Load(&state, s.accountID(), "withdrawal"); err != nil {
+		if !errors.Is(err, service.ErrPersistenceNotExists) {
+			log.WithError(err).Warnf("can not load the planned withdrawal")
+		}
+		return
+	}
+
+	s.statusMutex.Lock()
+	s.PlannedWithdrawal = state.Amount
+	s.statusMutex.Unlock()
+
+	log.Infof("restored the planned withdrawal of %s %s", state.Amount.String(), s.BaseCurrency)
+}